@@ -2,106 +2,414 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
-	"os/exec"
 	"os/signal"
-	"syscall"
+	"strings"
 	"time"
 
+	"github.com/fr0stylo/secretary/internal/audit"
+	"github.com/fr0stylo/secretary/internal/config"
+	"github.com/fr0stylo/secretary/internal/health"
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/metrics"
 	"github.com/fr0stylo/secretary/internal/providers"
 	"github.com/fr0stylo/secretary/internal/providers/aws"
+	"github.com/fr0stylo/secretary/internal/providers/azure"
 	"github.com/fr0stylo/secretary/internal/providers/dummy"
+	"github.com/fr0stylo/secretary/internal/providers/gcp"
+	"github.com/fr0stylo/secretary/internal/providers/vault"
+	"github.com/fr0stylo/secretary/internal/redact"
 	"github.com/fr0stylo/secretary/internal/secretmanager"
+	"github.com/fr0stylo/secretary/internal/supervisor"
+	"github.com/fr0stylo/secretary/internal/tracing"
 )
 
 var (
-	provider  = flag.String("provider", "mux", "The secret provider to use")
-	path      = flag.String("path", "/tmp", "The secret path to store secrets")
-	frequency = flag.Duration("frequency", 15*time.Second, "The frequency to check for secret changes")
-	timeout   = flag.Duration("timeout", 10*time.Second, "The timeout for secret retrieval operations")
+	provider        = flag.String("provider", "mux", "The secret provider to use")
+	path            = flag.String("path", "/tmp", "The secret path to store secrets")
+	frequency       = flag.Duration("frequency", 15*time.Second, "The frequency to check for secret changes")
+	timeout         = flag.Duration("timeout", 10*time.Second, "The timeout for secret retrieval operations")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "How long the application may take to exit after SIGTERM or SIGINT before it is killed")
+	initMode        = flag.Bool("init", os.Getpid() == 1, "Run as an init process: reap zombies and register as child subreaper (default when running as PID 1)")
+	processGroup    = flag.Bool("process-group", false, "Run the application in its own process group and signal the whole group")
+	onChange        = flag.String("on-change", "signal:SIGHUP", "How to notify the application of secret changes: signal[:<SIGNAL>], restart, exec:<command> or none")
+	frequencyJitter = flag.Float64("frequency-jitter", 0.1, "Shorten each interval between checks by up to this fraction at random")
+	retryAttempts   = flag.Int("retry-attempts", 5, "The maximum number of attempts for each provider call")
+	retryBackoff    = flag.Duration("retry-backoff", 500*time.Millisecond, "The delay before the first retry, doubled for each following one")
+	retryMaxBackoff = flag.Duration("retry-max-backoff", 10*time.Second, "The maximum delay between retries")
+	cacheDir        = flag.String("cache-dir", "", "Keep an encrypted cache of retrieved secrets in this directory and start from it when the provider is unavailable")
+	cacheKeyFile    = flag.String("cache-key-file", "", "The file holding the key that encrypts the cache")
+	cacheStaleness  = flag.Duration("cache-max-staleness", 24*time.Hour, "The maximum age of a cached secret that may be served, 0 for no limit")
+	healthAddr      = flag.String("health-addr", "", "Serve /healthz, /readyz and /status on this address, for example :8080")
+	healthStaleness = flag.Duration("health-max-staleness", 0, "How long ago a secret may have last been checked for secretary to stay ready (default four times -frequency)")
+	concurrency     = flag.Int("concurrency", secretmanager.DefaultConcurrency, "The maximum number of secrets retrieved in parallel")
+	symlinkSwap     = flag.Bool("symlink-swap", false, "Publish exploded secrets through an atomically swapped ..data symlink")
+	logLevel        = flag.String("log-level", "info", "The minimum level of logged events: debug, info, warn or error (SECRETARY_DEBUG=true sets debug)")
+	logFormat       = flag.String("log-format", "text", "The format of logged events: text or json")
+	redactOutput    = flag.Bool("redact-output", false, "Replace secret values in the output of the application with ***")
+	auditLog        = flag.String("audit-log", "", "Append a tamper-evident record of secret access and rotation to this file, or to stdout with -")
+	auditKeyFile    = flag.String("audit-key-file", "", "The file holding the key that chains audit entries and fingerprints secret values")
+	configFile      = flag.String("config", "", "Read secrets and settings from this YAML or TOML file; flags given on the command line take precedence")
+	templates       templateFlags
 )
 
+func init() {
+	flag.Var(&templates, "template", "A template to render as source:destination, may be repeated")
+}
+
+// templateFlags collects repeated -template source:destination flags.
+type templateFlags []*secretmanager.Template
+
+func (t *templateFlags) String() string {
+	parts := make([]string, 0, len(*t))
+	for _, tmpl := range *t {
+		parts = append(parts, tmpl.Source+":"+tmpl.Destination)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t *templateFlags) Set(value string) error {
+	source, destination, ok := strings.Cut(value, ":")
+	if !ok || source == "" || destination == "" {
+		return fmt.Errorf("template %q must have the form source:destination", value)
+	}
+	*t = append(*t, secretmanager.NewTemplate(source, destination))
+	return nil
+}
+
 func main() {
 	flag.Parse()
-	ctx, cancel := context.WithCancel(context.Background())
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	switch flag.Arg(0) {
+	case "health-check":
+		os.Exit(healthCheck())
+	case "audit":
+		os.Exit(auditCommand(flag.Args()[1:]))
+	}
+	os.Exit(run())
+}
+
+// setupLogging installs the default logger configured by the -log-* flags and SECRETARY_DEBUG.
+// Every record, including those of the standard log package, is redacted of secret values.
+func setupLogging() error {
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		return err
+	}
+	if logging.Debug() {
+		level = slog.LevelDebug
+	}
+	logger, err := logging.New(os.Stderr, *logFormat, level, redact.Default)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// healthCheck queries the readiness endpoint of a running secretary, for use as a container health check.
+func healthCheck() int {
+	if *healthAddr == "" {
+		slog.Error("health-check requires -health-addr")
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
 	defer cancel()
+	if err := health.Check(ctx, *healthAddr); err != nil {
+		slog.Error("Health check failed", logging.Err(err))
+		return 1
+	}
+	return 0
+}
 
-	var client secretmanager.Client
-	switch *provider {
-	case "mux":
-		client = providers.NewMux()
-	case "aws":
-		sm, err := aws.NewSecretsManager(ctx)
+// auditCommand runs the audit subcommands. audit verify [-key-file file] [log] checks the chain
+// of an audit log, read from stdin when no file is given or when it is -.
+func auditCommand(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		slog.Error("Usage: secretary audit verify [-key-file file] [log]")
+		return 2
+	}
+	fs := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	keyFile := fs.String("key-file", *auditKeyFile, "The file holding the key the audit log was written with")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	key, err := readKey(*keyFile, "audit verify requires -key-file or -audit-key-file")
+	if err != nil {
+		slog.Error("Invalid audit key", logging.Err(err))
+		return 2
+	}
+
+	in := os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
 		if err != nil {
-			log.Fatal(err)
+			slog.Error("Error opening audit log", logging.Err(err))
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	res, err := audit.Verify(in, key)
+	if err != nil {
+		slog.Error("Audit log verification failed", "entries", res.Entries, logging.Err(err))
+		return 1
+	}
+	if res.Truncated > 0 {
+		fmt.Printf("OK: %d entries in %d chains, %d torn by a crash, last hash %s\n", res.Entries, res.Chains, res.Truncated, res.Last)
+		return 0
+	}
+	fmt.Printf("OK: %d entries in %d chains, last hash %s\n", res.Entries, res.Chains, res.Last)
+	return 0
+}
+
+// readKey reads a key file, trimming surrounding whitespace. missing is the error reported
+// when no file is given.
+func readKey(path, missing string) ([]byte, error) {
+	if path == "" {
+		return nil, errors.New(missing)
+	}
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(key), nil
+}
+
+// run fetches the secrets, supervises the application and returns the exit code for secretary.
+// It returns instead of exiting so that deferred cleanups, such as removing secret files, always run.
+func run() int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		slog.Error("Invalid tracing configuration", logging.Err(err))
+		return 1
+	}
+	defer func() {
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(sctx); err != nil {
+			slog.Error("Error flushing traces", logging.Err(err))
+		}
+	}()
+
+	var cfg *config.File
+	if *configFile != "" {
+		if cfg, err = config.Load(*configFile); err != nil {
+			slog.Error("Invalid configuration file", logging.Err(err))
+			return 1
+		}
+		applyConfig(cfg)
+	}
+
+	policy, err := supervisor.ParsePolicy(*onChange)
+	if err != nil {
+		slog.Error("Invalid -on-change", logging.Err(err))
+		return 1
+	}
+
+	client, err := newClient(ctx, *provider)
+	if err != nil {
+		slog.Error("Invalid provider", logging.Provider, *provider, logging.Err(err))
+		return 1
+	}
+
+	var auditor *audit.Log
+	if *auditLog != "" {
+		key, err := readKey(*auditKeyFile, "-audit-log requires -audit-key-file")
+		if err == nil {
+			auditor, err = audit.Open(*auditLog, key)
 		}
-		client = sm
-	case "awsssm":
-		sm, err := aws.NewSSM(ctx)
 		if err != nil {
-			log.Fatal(err)
+			slog.Error("Invalid audit log", logging.Err(err))
+			return 1
 		}
-		client = sm
-	case "dummy":
-		client = dummy.NewSecretManager()
+		defer auditor.Close()
 	}
 
-	sc := secretmanager.NewRetriever(client,
+	opts := []secretmanager.ConfigOption{
 		secretmanager.WithFrequency(*frequency),
 		secretmanager.WithTimeout(*timeout),
-		secretmanager.WithPath(*path))
-	if err := sc.CreateSecretsFromEnvironment(ctx, os.Environ()); err != nil {
-		log.Fatal(err)
+		secretmanager.WithPath(*path),
+		secretmanager.WithSymlinkSwap(*symlinkSwap),
+		secretmanager.WithConcurrency(*concurrency),
+		secretmanager.WithFrequencyJitter(*frequencyJitter),
+		secretmanager.WithRetryPolicy(retryPolicy()),
+		secretmanager.WithAudit(auditor),
 	}
+	if *cacheDir != "" {
+		cache, err := newCache()
+		if err != nil {
+			slog.Error("Invalid cache", logging.Err(err))
+			return 1
+		}
+		opts = append(opts, secretmanager.WithCache(cache))
+	}
+	sc := secretmanager.NewRetriever(client, opts...)
 	defer sc.Clean()
 
+	svOpts := []supervisor.Option{
+		supervisor.WithShutdownTimeout(*shutdownTimeout),
+		supervisor.WithInit(*initMode),
+		supervisor.WithProcessGroup(*processGroup),
+		supervisor.WithPolicy(policy),
+		supervisor.WithAudit(auditor),
+		supervisor.WithRotatedValues(redact.Default),
+	}
+	if *redactOutput {
+		svOpts = append(svOpts, supervisor.WithRedactedOutput(redact.Default))
+	}
+	sv := supervisor.New(flag.Args(), svOpts...)
+
+	var hs *health.Server
+	if *healthAddr != "" {
+		staleness := *healthStaleness
+		if staleness == 0 {
+			staleness = 4 * *frequency
+		}
+		hs = health.New(sc, health.WithAlive(sv.Alive), health.WithMaxStaleness(staleness), health.WithFrequency(*frequency))
+		go func() {
+			if err := hs.ListenAndServe(ctx, *healthAddr); err != nil {
+				slog.Error("Health endpoint failed", logging.Err(err))
+			}
+		}()
+	}
+
+	if cfg == nil {
+		err = sc.CreateSecretsFromEnvironment(ctx, os.Environ())
+	} else {
+		secrets, envErr := sc.SecretsFromEnvironment(os.Environ())
+		if envErr != nil {
+			slog.Error("Invalid secret declaration", logging.Err(envErr))
+			return 1
+		}
+		err = sc.CreateSecrets(ctx, secretmanager.MergeSecrets(cfg.BuildSecrets(*path), secrets))
+	}
+	if err != nil {
+		slog.Error("Error retrieving secrets", logging.Err(err))
+		return 1
+	}
+	for _, secret := range sc.Secrets() {
+		if secret.OnChange == "" {
+			continue
+		}
+		if _, err := supervisor.ParsePolicy(secret.OnChange); err != nil {
+			slog.Error("Invalid on-change option", logging.EnvName, secret.EnvName, logging.Err(err))
+			return 1
+		}
+	}
+	for _, tmpl := range templates {
+		if err := sc.CreateTemplate(ctx, tmpl); err != nil {
+			slog.Error("Error rendering template", logging.Template, tmpl.Source, logging.Err(err))
+			return 1
+		}
+	}
+	if sc.Degraded() {
+		slog.Warn("Starting in degraded mode, some secrets are served from the cache")
+	}
+	if hs != nil {
+		hs.MarkStarted()
+	}
+
 	watcher := secretmanager.NewWatcher(sc)
 	changeCh := watcher.Start(ctx)
 	defer watcher.Stop()
 
-	if err := runApplication(ctx, changeCh, flag.Args()); err != nil {
-		log.Fatal(err)
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, supervisor.ForwardedSignals...)
+
+	err = sv.Run(ctx, signalCh, changeCh)
+	code := supervisor.ExitCode(err)
+	if code != 0 {
+		slog.Error("Application exited", "exit_code", code, logging.Err(err))
 	}
+	return code
 }
 
-func runApplication(ctx context.Context, changeCh chan string, args []string) error {
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stdin = os.Stdin
-	cmd.Stderr = os.Stderr
-	cmd.Env = os.Environ()
+// applyConfig applies the settings of the configuration file to the flags that were not given
+// on the command line, and adds the templates it declares to those of the -template flags.
+func applyConfig(f *config.File) {
+	set := make(map[string]bool)
+	flag.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	if f.Provider != "" && !set["provider"] {
+		*provider = f.Provider
+	}
+	if f.Path != "" && !set["path"] {
+		*path = f.Path
+	}
+	if f.Frequency != 0 && !set["frequency"] {
+		*frequency = time.Duration(f.Frequency)
+	}
+	if f.Timeout != 0 && !set["timeout"] {
+		*timeout = time.Duration(f.Timeout)
+	}
+	if f.OnChange != "" && !set["on-change"] {
+		*onChange = f.OnChange
+	}
+	templates = append(templates, f.BuildTemplates()...)
+}
 
-	if err := cmd.Start(); err != nil {
-		return err
+// newCache creates the secret cache configured by the -cache-* flags.
+func newCache() (*secretmanager.Cache, error) {
+	key, err := readKey(*cacheKeyFile, "-cache-dir requires -cache-key-file")
+	if err != nil {
+		return nil, err
 	}
+	return secretmanager.NewCache(*cacheDir, key, *cacheStaleness)
+}
 
-	complete := make(chan error)
-	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, syscall.SIGTERM, syscall.SIGINT)
+// retryPolicy returns the retry policy configured by the -retry-* flags.
+func retryPolicy() secretmanager.RetryPolicy {
+	p := secretmanager.DefaultRetryPolicy()
+	p.MaxAttempts = *retryAttempts
+	p.InitialBackoff = *retryBackoff
+	p.MaxBackoff = *retryMaxBackoff
+	return p
+}
 
-	go func() {
-		complete <- cmd.Wait()
-	}()
+// newClient creates the secret manager client for the named provider, instrumented with metrics.
+// The mux instruments every provider it routes to under the provider's own name.
+func newClient(ctx context.Context, name string) (secretmanager.Client, error) {
+	if name == "mux" {
+		m := providers.NewMux()
+		m.Use(func(provider string, client secretmanager.Client) secretmanager.Client {
+			return metrics.Wrap(provider, client)
+		})
+		return m, nil
+	}
+	client, err := newProvider(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return metrics.Wrap(name, client), nil
+}
 
-	for {
-		select {
-		case change := <-changeCh:
-			log.Printf("Change detected: %s, Sending SIGHUP to %d", change, cmd.Process.Pid)
-			if err := cmd.Process.Signal(syscall.SIGHUP); err != nil {
-				return err
-			}
-		case <-signalCh:
-			log.Printf("Received signal, sending SIGKILL to %d", cmd.Process.Pid)
-			if err := cmd.Process.Signal(syscall.SIGKILL); err != nil {
-				return err
-			}
-			return nil
-		case err := <-complete:
-			return err
-		}
+// newProvider creates the secret manager client for the named provider.
+func newProvider(ctx context.Context, name string) (secretmanager.Client, error) {
+	switch name {
+	case "aws":
+		return aws.NewSecretsManager(ctx)
+	case "awsssm":
+		return aws.NewSSM(ctx)
+	case "vault":
+		return vault.NewKV(ctx)
+	case "gcp":
+		return gcp.NewSecretManager(ctx)
+	case "azure":
+		return azure.NewKeyVault(ctx)
+	case "dummy":
+		return dummy.NewSecretManager(), nil
 	}
+	return nil, fmt.Errorf("unknown provider %q", name)
 }
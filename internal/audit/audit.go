@@ -0,0 +1,315 @@
+// Package audit keeps a tamper-evident, append-only record of secret access and rotation.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/logging"
+)
+
+// Stream tags every audit entry, so that entries written on stdout can be told apart from
+// the rest of the output.
+const Stream = "secretary.audit"
+
+// Event types.
+const (
+	// EventFetch records the retrieval of a secret from its provider or the cache.
+	EventFetch = "fetch"
+	// EventVersionChange records a new version of a secret detected by the watcher.
+	EventVersionChange = "version_change"
+	// EventWrite records a secret or template written to a file or the environment.
+	EventWrite = "write"
+	// EventCleanup records the removal of a secret or template at shutdown.
+	EventCleanup = "cleanup"
+	// EventNotify records the application being notified of a change.
+	EventNotify = "notify"
+	// EventTruncated records that the log ended with an entry torn by a crash when it was reopened.
+	// The torn entry is kept as is and the chain continues from the last complete entry.
+	EventTruncated = "truncated"
+)
+
+// Entry is one line of the audit log. Entries are chained: Hash is an HMAC of the entry,
+// which includes the Hash of the previous one, so that modifying, removing or reordering
+// entries breaks the chain.
+type Entry struct {
+	Stream          string    `json:"stream"`
+	Seq             uint64    `json:"seq"`
+	Time            time.Time `json:"time"`
+	Event           string    `json:"event"`
+	Identifier      string    `json:"identifier,omitempty"`
+	EnvName         string    `json:"env_name,omitempty"`
+	Version         string    `json:"version,omitempty"`
+	PreviousVersion string    `json:"previous_version,omitempty"`
+	Path            string    `json:"path,omitempty"`
+	Template        string    `json:"template,omitempty"`
+	// Fingerprint is an HMAC of the secret value, never the value itself.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Stale       bool   `json:"stale,omitempty"`
+	// Action describes how the application was notified, such as signal:SIGHUP.
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Prev   string `json:"prev"`
+	Hash   string `json:"hash,omitempty"`
+}
+
+// Log appends entries to an audit sink. A nil *Log records nothing, so that callers need not
+// check whether auditing is enabled. It is safe for concurrent use.
+type Log struct {
+	mu             sync.Mutex
+	w              io.Writer
+	closer         io.Closer
+	chainKey       []byte
+	fingerprintKey []byte
+	seq            uint64
+	prev           string
+}
+
+// deriveKeys derives the keys of the chain and of value fingerprints from key.
+func deriveKeys(key []byte) (chainKey, fingerprintKey []byte) {
+	derive := func(purpose string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(purpose))
+		return mac.Sum(nil)
+	}
+	return derive("secretary audit chain"), derive("secretary audit fingerprint")
+}
+
+// New creates a Log writing entries to w, starting a new chain.
+func New(w io.Writer, key []byte) (*Log, error) {
+	if len(key) == 0 {
+		return nil, errors.New("audit key must not be empty")
+	}
+	l := &Log{w: w}
+	l.chainKey, l.fingerprintKey = deriveKeys(key)
+	return l, nil
+}
+
+// Open creates a Log appending entries to the file at path, or writing them on stdout when
+// path is "-". Entries appended to an existing file continue its chain. When the file ends with
+// an entry torn by a crash, it is terminated and followed by an EventTruncated entry, rather than
+// keeping secretary from starting.
+func Open(path string, key []byte) (*Log, error) {
+	if path == "-" {
+		return New(os.Stdout, key)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l, err := New(f, key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.closer = f
+	var last *Entry
+	torn, err := scan(f, func(e *Entry) error {
+		last = e
+		return nil
+	})
+	if err == nil {
+		err = terminate(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading audit log %s: %w", path, err)
+	}
+	if last != nil {
+		l.seq, l.prev = last.Seq, last.Hash
+	}
+	if torn {
+		slog.Warn("Audit log ends with an incomplete entry, recording the truncation", logging.Path, path)
+		l.Record(Entry{Event: EventTruncated, Error: "incomplete entry after a crash"})
+	}
+	return l, nil
+}
+
+// terminate ends the file with a newline, so that appended entries start on a line of their own.
+func terminate(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	_, err = f.Write([]byte{'\n'})
+	return err
+}
+
+// scan calls fn with every entry read from r. Lines that are not audit entries are skipped.
+// An entry torn by a crash is tolerated when it is the unterminated last line, reported as torn,
+// or when it is followed by an EventTruncated entry or the start of a new chain; any other
+// entry that cannot be decoded is an error.
+func scan(r io.Reader, fn func(*Entry) error) (torn bool, err error) {
+	br := bufio.NewReader(r)
+	var invalid error // an entry that cannot be decoded, tolerated if the next entry accounts for it
+	for {
+		raw, readErr := br.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return false, readErr
+		}
+		line := bytes.TrimSpace(raw)
+		if bytes.HasPrefix(line, []byte(`{"stream":"`+Stream+`"`)) {
+			var e Entry
+			dec := json.NewDecoder(bytes.NewReader(line))
+			dec.DisallowUnknownFields()
+			switch err := dec.Decode(&e); {
+			case err != nil && readErr == io.EOF:
+				return true, invalid
+			case invalid != nil && (err != nil || (e.Event != EventTruncated && e.Seq != 1)):
+				return false, invalid
+			case err != nil:
+				invalid = fmt.Errorf("invalid audit entry %q: %w", line, err)
+			default:
+				invalid = nil
+				if err := fn(&e); err != nil {
+					return false, err
+				}
+			}
+		}
+		if readErr == io.EOF {
+			return false, invalid
+		}
+	}
+}
+
+// Fingerprint returns an HMAC of a secret value identifying it without revealing it.
+func (l *Log) Fingerprint(value []byte) string {
+	if l == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, l.fingerprintKey)
+	mac.Write(value)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Record appends an entry to the log, filling in its stream, sequence number, time and chain
+// hashes. Failures to write are logged, as auditing must not stop secretary.
+func (l *Log) Record(e Entry) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Stream = Stream
+	e.Seq = l.seq + 1
+	e.Time = time.Now().UTC()
+	e.Prev = l.prev
+	e.Hash = ""
+	hash, err := chainHash(l.chainKey, &e)
+	if err != nil {
+		slog.Error("Error encoding audit entry", logging.Err(err))
+		return
+	}
+	e.Hash = hash
+	line, err := json.Marshal(&e)
+	if err != nil {
+		slog.Error("Error encoding audit entry", logging.Err(err))
+		return
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		slog.Error("Error writing audit entry", logging.Err(err))
+		return
+	}
+	l.seq, l.prev = e.Seq, e.Hash
+}
+
+// Close closes the audit log file.
+func (l *Log) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// chainHash returns the HMAC of an entry without its Hash.
+func chainHash(key []byte, e *Entry) (string, error) {
+	unhashed := *e
+	unhashed.Hash = ""
+	b, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Result summarizes a verified audit log.
+type Result struct {
+	// Entries is the number of entries verified.
+	Entries int
+	// Chains is the number of chains the entries form. Every run writing on stdout starts
+	// a new chain.
+	Chains int
+	// Last is the hash of the last entry, which may be kept elsewhere to detect later truncation.
+	Last string
+	// Truncated is the number of entries torn by a crash, either recorded by an EventTruncated
+	// entry or found at the end of the log.
+	Truncated int
+}
+
+// Verify checks the chain of the audit entries read from r with the key they were written with.
+// Lines that are not audit entries, such as the output of the application sharing stdout, are
+// skipped. The first entry may continue a chain whose beginning was rotated away, and a new
+// chain may start at any point with an entry numbered 1. Entries torn by a crash are counted
+// in Truncated rather than failing verification.
+func Verify(r io.Reader, key []byte) (Result, error) {
+	if len(key) == 0 {
+		return Result{}, errors.New("audit key must not be empty")
+	}
+	chainKey, _ := deriveKeys(key)
+	var res Result
+	var prev *Entry
+	torn, err := scan(r, func(e *Entry) error {
+		hash, err := chainHash(chainKey, e)
+		if err != nil {
+			return err
+		}
+		if !hmac.Equal([]byte(hash), []byte(e.Hash)) {
+			return fmt.Errorf("entry %d: hash mismatch, the entry was modified or written with another key", e.Seq)
+		}
+		switch {
+		case e.Seq == 1:
+			if e.Prev != "" {
+				return errors.New("entry 1: unexpected previous hash")
+			}
+			res.Chains++
+		case prev == nil:
+			res.Chains++
+		case e.Prev != prev.Hash:
+			return fmt.Errorf("entry %d: does not follow entry %d", e.Seq, prev.Seq)
+		case e.Seq != prev.Seq+1:
+			return fmt.Errorf("entry %d: expected sequence number %d", e.Seq, prev.Seq+1)
+		}
+		if e.Event == EventTruncated {
+			res.Truncated++
+		}
+		prev = e
+		res.Entries++
+		res.Last = e.Hash
+		return nil
+	})
+	if torn {
+		res.Truncated++
+	}
+	return res, err
+}
@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var key = []byte("audit-key")
+
+func writeEntries(t *testing.T, l *Log, n int) {
+	t.Helper()
+	for i := range n {
+		l.Record(Entry{Event: EventFetch, Identifier: "prod/db", Version: string(rune('a' + i)), Fingerprint: l.Fingerprint([]byte("value"))})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, l, 3)
+
+	res, err := Verify(bytes.NewReader(buf.Bytes()), key)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if res.Entries != 3 || res.Chains != 1 || res.Last == "" {
+		t.Errorf("Unexpected result %+v", res)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := New(&buf, key)
+	writeEntries(t, l, 3)
+	lines := strings.SplitAfter(strings.TrimSpace(buf.String()), "\n")
+
+	tests := map[string]string{
+		"modified":      strings.Replace(buf.String(), `"version":"b"`, `"version":"x"`, 1),
+		"removed":       lines[0] + lines[2],
+		"reordered":     lines[1] + lines[0] + lines[2],
+		"unknown field": strings.Replace(buf.String(), `"version":"b"`, `"version":"b","extra":"x"`, 1),
+	}
+	for name, tampered := range tests {
+		if _, err := Verify(strings.NewReader(tampered), key); err == nil {
+			t.Errorf("%s: expected Verify to fail", name)
+		}
+	}
+	if _, err := Verify(bytes.NewReader(buf.Bytes()), []byte("other-key")); err == nil {
+		t.Error("Expected Verify to fail with another key")
+	}
+}
+
+func TestOpenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for range 2 {
+		l, err := Open(path, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeEntries(t, l, 2)
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	res, err := Verify(f, key)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if res.Entries != 4 || res.Chains != 1 {
+		t.Errorf("Expected one chain of 4 entries, got %+v", res)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestVerifySkipsOtherOutput(t *testing.T) {
+	var buf bytes.Buffer
+	for range 2 {
+		l, _ := New(&buf, key)
+		buf.WriteString("application output\n")
+		writeEntries(t, l, 2)
+		buf.WriteString(`{"level":"info","msg":"application log"}` + "\n")
+	}
+
+	res, err := Verify(bytes.NewReader(buf.Bytes()), key)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if res.Entries != 4 || res.Chains != 2 {
+		t.Errorf("Expected two chains of 2 entries, got %+v", res)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	l, _ := New(&bytes.Buffer{}, key)
+	other, _ := New(&bytes.Buffer{}, []byte("other-key"))
+
+	fp := l.Fingerprint([]byte("value"))
+	if fp != l.Fingerprint([]byte("value")) || fp == l.Fingerprint([]byte("other")) {
+		t.Error("Expected fingerprints to identify values")
+	}
+	if fp == other.Fingerprint([]byte("value")) {
+		t.Error("Expected fingerprints to depend on the key")
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	l.Record(Entry{Event: EventFetch})
+	if l.Fingerprint([]byte("value")) != "" || l.Close() != nil {
+		t.Error("Expected a nil Log to record nothing")
+	}
+}
+
+func TestOpenRecoversFromTornEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntries(t, l, 3)
+	l.Close()
+
+	// A crash while writing the third entry leaves it incomplete.
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content[:len(content)-40], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Verify(bytes.NewReader(content[:len(content)-40]), key)
+	if err != nil {
+		t.Fatalf("Verify failed on a torn last entry: %v", err)
+	}
+	if res.Entries != 2 || res.Truncated != 1 {
+		t.Errorf("Expected 2 entries and a truncated one, got %+v", res)
+	}
+
+	l, err = Open(path, key)
+	if err != nil {
+		t.Fatalf("Open failed on a torn last entry: %v", err)
+	}
+	writeEntries(t, l, 1)
+	l.Close()
+
+	content, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"event":"truncated"`) {
+		t.Errorf("Expected a truncated entry, got %s", content)
+	}
+	res, err = Verify(bytes.NewReader(content), key)
+	if err != nil {
+		t.Fatalf("Verify failed after recovery: %v", err)
+	}
+	if res.Entries != 4 || res.Chains != 1 || res.Truncated != 1 {
+		t.Errorf("Expected one chain of 4 entries with a truncation, got %+v", res)
+	}
+
+	// A torn entry that is not accounted for by the following entry is tampering.
+	lines := strings.SplitAfter(string(content), "\n")
+	tampered := lines[0] + lines[1][:len(lines[1])/2] + "\n" + lines[1] + lines[2]
+	if _, err := Verify(strings.NewReader(tampered), key); err == nil {
+		t.Error("Expected Verify to fail on an incomplete entry in the middle of a chain")
+	}
+}
@@ -0,0 +1,350 @@
+// Package config loads the secrets and settings of secretary from a YAML or TOML file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+	"github.com/fr0stylo/secretary/internal/supervisor"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// File is a configuration file. Settings left out are zero, so that the defaults of the
+// corresponding flags apply.
+type File struct {
+	Provider  string     `yaml:"provider" toml:"provider"`
+	Path      string     `yaml:"path" toml:"path"`
+	Frequency Duration   `yaml:"frequency" toml:"frequency"`
+	Timeout   Duration   `yaml:"timeout" toml:"timeout"`
+	OnChange  string     `yaml:"on_change" toml:"on_change"`
+	Templates []Template `yaml:"templates" toml:"templates"`
+	Secrets   []Secret   `yaml:"secrets" toml:"secrets"`
+
+	// name is the path the file was loaded from, for the Source of its secrets.
+	name string
+}
+
+// Template is a template to render, like the -template flag.
+type Template struct {
+	Source      string `yaml:"source" toml:"source"`
+	Destination string `yaml:"destination" toml:"destination"`
+}
+
+// Secret declares a secret, with the options otherwise given in the query of a SECRETARY_ variable.
+type Secret struct {
+	// Name is the name of the secret file, and of the variable when injected into the environment.
+	Name string `yaml:"name" toml:"name"`
+	// ID is the provider identifier of the secret.
+	ID string `yaml:"id" toml:"id"`
+	// Key selects a field of a JSON secret, or * to write every field to its own file.
+	Key string `yaml:"key" toml:"key"`
+	// Path is where the secret is written, relative to the global path. Defaults to Name.
+	Path string `yaml:"path" toml:"path"`
+	// Mode holds octal file permissions such as "0440".
+	Mode     string   `yaml:"mode" toml:"mode"`
+	UID      *int     `yaml:"uid" toml:"uid"`
+	GID      *int     `yaml:"gid" toml:"gid"`
+	Format   string   `yaml:"format" toml:"format"`
+	OnChange string   `yaml:"on_change" toml:"on_change"`
+	Inject   string   `yaml:"inject" toml:"inject"`
+	Refresh  Duration `yaml:"refresh" toml:"refresh"`
+
+	// line is where the secret is declared, 0 when unknown.
+	line int
+}
+
+// Duration is a time.Duration written as a string such as 30s or 5m.
+type Duration time.Duration
+
+// UnmarshalText parses a duration string.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return fmt.Errorf("negative duration %s", text)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalYAML parses a duration string, reporting the line of invalid ones. The error is a
+// *yaml.TypeError, so that the decoder goes on to report the problems found after it.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	if err := d.UnmarshalText([]byte(value.Value)); err != nil {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %v", value.Line, err)}}
+	}
+	return nil
+}
+
+// Load reads the configuration file at name, in YAML or TOML depending on its extension.
+// Unknown fields are rejected and the file is validated, reporting every problem along with
+// the line it was found on. A TOML value that cannot be decoded stops decoding, so only the first
+// one is reported.
+func Load(name string) (*File, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{name: name}
+	switch ext := filepath.Ext(name); ext {
+	case ".yaml", ".yml":
+		err = f.decodeYAML(data)
+	case ".toml":
+		err = f.decodeTOML(data)
+	default:
+		return nil, fmt.Errorf("unsupported configuration file %s, expected a .yaml, .yml or .toml extension", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// decodeYAML decodes a YAML document strictly, then walks it again for the lines of the secrets.
+func (f *File) decodeYAML(data []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(f); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			errs := make([]error, 0, len(typeErr.Errors))
+			for _, msg := range typeErr.Errors {
+				errs = append(errs, f.yamlError(msg))
+			}
+			return errors.Join(errs...)
+		}
+		return f.yamlError(strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "secrets" {
+			continue
+		}
+		for j, item := range root.Content[i+1].Content {
+			if j < len(f.Secrets) {
+				f.Secrets[j].line = item.Line
+			}
+		}
+	}
+	return nil
+}
+
+// yamlError turns a "line N: message" error of the YAML decoder into "file:N: message".
+func (f *File) yamlError(msg string) error {
+	if rest, ok := strings.CutPrefix(msg, "line "); ok {
+		if line, msg, ok := strings.Cut(rest, ": "); ok {
+			return fmt.Errorf("%s:%s: %s", f.name, line, msg)
+		}
+	}
+	return fmt.Errorf("%s: %s", f.name, msg)
+}
+
+// decodeTOML decodes a TOML document strictly, then parses it again for the lines of the secrets.
+func (f *File) decodeTOML(data []byte) error {
+	dec := toml.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(f); err != nil {
+		var strictErr *toml.StrictMissingError
+		if errors.As(err, &strictErr) {
+			errs := make([]error, 0, len(strictErr.Errors))
+			for _, e := range strictErr.Errors {
+				line, _ := e.Position()
+				errs = append(errs, fmt.Errorf("%s:%d: unknown field %s", f.name, line, strings.Join(e.Key(), ".")))
+			}
+			return errors.Join(errs...)
+		}
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			line, _ := decodeErr.Position()
+			return fmt.Errorf("%s:%d: %s", f.name, line, decodeErr.Error())
+		}
+		return fmt.Errorf("%s: %w", f.name, err)
+	}
+
+	for i, line := range secretLines(data) {
+		if i < len(f.Secrets) {
+			f.Secrets[i].line = line
+		}
+	}
+	return nil
+}
+
+// secretLines returns the lines declaring the secrets of a TOML document, in order: the headers of
+// [[secrets]] tables, or the inline tables of a secrets array.
+func secretLines(data []byte) []int {
+	var lines []int
+	p := unstable.Parser{}
+	p.Reset(data)
+	topLevel := true
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table:
+			topLevel = false
+		case unstable.ArrayTable:
+			topLevel = false
+			if isKey(expr.Key(), "secrets") {
+				lines = append(lines, p.Shape(expr.Child().Raw).Start.Line)
+			}
+		case unstable.KeyValue:
+			if !topLevel || !isKey(expr.Key(), "secrets") || expr.Value().Kind != unstable.Array {
+				continue
+			}
+			items := expr.Value().Children()
+			for items.Next() {
+				lines = append(lines, p.Shape(items.Node().Raw).Start.Line)
+			}
+		}
+	}
+	return lines
+}
+
+// isKey reports whether the key is the single part name.
+func isKey(key unstable.Iterator, name string) bool {
+	return key.Next() && string(key.Node().Data) == name && !key.Next()
+}
+
+// envName matches the names that can be given to environment variables.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validate checks the settings and secrets of the file, reporting every problem found.
+func (f *File) validate() error {
+	var errs []error
+	if f.OnChange != "" {
+		if _, err := supervisor.ParsePolicy(f.OnChange); err != nil {
+			errs = append(errs, fmt.Errorf("%s: on_change: %w", f.name, err))
+		}
+	}
+	for i, t := range f.Templates {
+		if t.Source == "" || t.Destination == "" {
+			errs = append(errs, fmt.Errorf("%s: templates[%d]: source and destination are required", f.name, i))
+		}
+	}
+
+	declared := make(map[string]int)
+	for i := range f.Secrets {
+		s := &f.Secrets[i]
+		if j, ok := declared[s.Name]; ok && s.Name != "" {
+			errs = append(errs, fmt.Errorf("%s: duplicate secret %s, first declared at %s", f.position(i), s.Name, f.position(j)))
+			continue
+		}
+		declared[s.Name] = i
+		if _, err := s.build(""); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.position(i), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// position describes where the i-th secret is declared.
+func (f *File) position(i int) string {
+	if line := f.Secrets[i].line; line > 0 {
+		return fmt.Sprintf("%s:%d", f.name, line)
+	}
+	return fmt.Sprintf("%s: secrets[%d]", f.name, i)
+}
+
+// BuildSecrets returns the secrets declared in the file, written under dir unless their path
+// is absolute.
+func (f *File) BuildSecrets(dir string) []*secretmanager.Secret {
+	secrets := make([]*secretmanager.Secret, 0, len(f.Secrets))
+	for i := range f.Secrets {
+		s, err := f.Secrets[i].build(dir)
+		if err != nil {
+			// Load validated every secret.
+			continue
+		}
+		s.Source = f.position(i)
+		secrets = append(secrets, s)
+	}
+	return secrets
+}
+
+// BuildTemplates returns the templates declared in the file.
+func (f *File) BuildTemplates() []*secretmanager.Template {
+	templates := make([]*secretmanager.Template, 0, len(f.Templates))
+	for _, t := range f.Templates {
+		templates = append(templates, secretmanager.NewTemplate(t.Source, t.Destination))
+	}
+	return templates
+}
+
+// build creates the secret written under dir. The options are applied through
+// Secret.SetOptions, so they are validated exactly like those of SECRETARY_ variables.
+func (s *Secret) build(dir string) (*secretmanager.Secret, error) {
+	if !envName.MatchString(s.Name) {
+		return nil, fmt.Errorf("invalid secret name %q, expected letters, digits and underscores", s.Name)
+	}
+	if s.ID == "" {
+		return nil, fmt.Errorf("secret %s: id is required", s.Name)
+	}
+	if strings.ContainsAny(s.ID, "#?") {
+		return nil, fmt.Errorf("secret %s: id %q must not contain # or ?, select a JSON key with key and set options with their own fields", s.Name, s.ID)
+	}
+	if s.OnChange != "" {
+		if _, err := supervisor.ParsePolicy(s.OnChange); err != nil {
+			return nil, fmt.Errorf("secret %s: on_change: %w", s.Name, err)
+		}
+	}
+
+	options := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			options.Set(name, value)
+		}
+	}
+	set("mode", s.Mode)
+	if s.UID != nil {
+		set("uid", strconv.Itoa(*s.UID))
+	}
+	if s.GID != nil {
+		set("gid", strconv.Itoa(*s.GID))
+	}
+	set("format", s.Format)
+	set("on-change", s.OnChange)
+	set("inject", s.Inject)
+	if s.Refresh != 0 {
+		set("refresh", time.Duration(s.Refresh).String())
+	}
+
+	secretPath := s.Path
+	if secretPath == "" {
+		secretPath = s.Name
+	}
+	if !path.IsAbs(secretPath) {
+		secretPath = path.Join(dir, secretPath)
+	}
+	secret := &secretmanager.Secret{
+		Identifier: s.ID,
+		Key:        s.Key,
+		EnvName:    s.Name,
+		Path:       secretPath,
+	}
+	if err := secret.SetOptions(options.Encode()); err != nil {
+		return nil, fmt.Errorf("secret %s: %w", s.Name, err)
+	}
+	return secret, nil
+}
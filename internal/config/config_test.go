@@ -0,0 +1,266 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+)
+
+const testYAML = `provider: aws
+path: /run/secrets
+frequency: 30s
+timeout: 5s
+on_change: signal:SIGUSR1
+templates:
+  - source: app.yaml.tmpl
+    destination: /etc/app.yaml
+secrets:
+  - name: DB_PASSWORD
+    id: prod/db
+    key: password
+    mode: 0440
+    uid: 1000
+    gid: 2000
+    on_change: restart
+    refresh: 5m
+  - name: KEYSTORE
+    id: prod/keystore
+    format: base64
+    path: /etc/ssl/keystore.p12
+  - name: API_KEY
+    id: prod/api
+    inject: env
+`
+
+const testTOML = `provider = "aws"
+path = "/run/secrets"
+frequency = "30s"
+timeout = "5s"
+on_change = "signal:SIGUSR1"
+
+[[templates]]
+source = "app.yaml.tmpl"
+destination = "/etc/app.yaml"
+
+[[secrets]]
+name = "DB_PASSWORD"
+id = "prod/db"
+key = "password"
+mode = "0440"
+uid = 1000
+gid = 2000
+on_change = "restart"
+refresh = "5m"
+
+[[secrets]]
+name = "KEYSTORE"
+id = "prod/keystore"
+format = "base64"
+path = "/etc/ssl/keystore.p12"
+
+[[secrets]]
+name = "API_KEY"
+id = "prod/api"
+inject = "env"
+`
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		lines   []int
+	}{
+		"secretary.yaml": {testYAML, []int{10, 18, 22}},
+		"secretary.toml": {testTOML, []int{11, 21, 27}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfig(t, name, tt.content)
+			f, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if f.Provider != "aws" || f.Path != "/run/secrets" || f.OnChange != "signal:SIGUSR1" {
+				t.Errorf("Unexpected settings %+v", f)
+			}
+			if time.Duration(f.Frequency) != 30*time.Second || time.Duration(f.Timeout) != 5*time.Second {
+				t.Errorf("Expected frequency 30s and timeout 5s, got %v and %v", time.Duration(f.Frequency), time.Duration(f.Timeout))
+			}
+			templates := f.BuildTemplates()
+			if len(templates) != 1 || templates[0].Source != "app.yaml.tmpl" || templates[0].Destination != "/etc/app.yaml" {
+				t.Errorf("Unexpected templates %+v", templates)
+			}
+
+			secrets := f.BuildSecrets("/run/secrets")
+			if len(secrets) != 3 {
+				t.Fatalf("Expected 3 secrets, got %d", len(secrets))
+			}
+			for i, s := range secrets {
+				if want := path + ":" + strconv.Itoa(tt.lines[i]); s.Source != want {
+					t.Errorf("Expected %s to be declared at %s, got %s", s.EnvName, want, s.Source)
+				}
+			}
+			db, keystore, api := secrets[0], secrets[1], secrets[2]
+			if db.Identifier != "prod/db" || db.Key != "password" || db.Path != "/run/secrets/DB_PASSWORD" {
+				t.Errorf("Unexpected secret %+v", db)
+			}
+			if db.Mode != 0o440 || db.UID == nil || *db.UID != 1000 || db.GID == nil || *db.GID != 2000 {
+				t.Errorf("Expected mode 0440 owned by 1000:2000, got %o %v %v", db.Mode, db.UID, db.GID)
+			}
+			if db.OnChange != "restart" || db.Refresh != 5*time.Minute {
+				t.Errorf("Expected restart every 5m, got %q %v", db.OnChange, db.Refresh)
+			}
+			if keystore.Format != secretmanager.FormatBase64 || keystore.Path != "/etc/ssl/keystore.p12" {
+				t.Errorf("Unexpected secret %+v", keystore)
+			}
+			if !api.InjectEnv {
+				t.Error("Expected API_KEY to be injected into the environment")
+			}
+		})
+	}
+}
+
+func TestLoadTOMLSecretLines(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		lines   []int
+	}{
+		"tables": {
+			content: "provider = \"aws\"\n\n[[ secrets ]] # database\nname = \"DB\"\nid = \"prod/db\"\n\n[[templates]]\nsource = \"a.tmpl\"\ndestination = \"/etc/a\"\n\n[[\"secrets\"]]\nname = \"API\"\nid = \"prod/api\"\n",
+			lines:   []int{3, 11},
+		},
+		"inline": {
+			content: "provider = \"aws\"\nsecrets = [\n  { name = \"DB\", id = \"prod/db\" },\n\n  { name = \"API\", id = \"prod/api\" },\n]\n",
+			lines:   []int{3, 5},
+		},
+		"one line": {
+			content: "secrets = [{ name = \"DB\", id = \"prod/db\" }, { name = \"API\", id = \"prod/api\" }]\n",
+			lines:   []int{1, 1},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfig(t, "secretary.toml", tt.content)
+			f, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			secrets := f.BuildSecrets("/run/secrets")
+			if len(secrets) != len(tt.lines) {
+				t.Fatalf("Expected %d secrets, got %d", len(tt.lines), len(secrets))
+			}
+			for i, s := range secrets {
+				if want := path + ":" + strconv.Itoa(tt.lines[i]); s.Source != want {
+					t.Errorf("Expected %s to be declared at %s, got %s", s.EnvName, want, s.Source)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadEmpty(t *testing.T) {
+	f, err := Load(writeConfig(t, "secretary.yaml", ""))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(f.BuildSecrets("/tmp")) != 0 {
+		t.Error("Expected no secrets")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "secretary.yaml",
+			content: "frequency: 30s\nsecrets:\n  - name: DB\n    id: prod/db\n    owner: root\n",
+			want:    []string{"secretary.yaml:5: field owner not found"},
+		},
+		{
+			name:    "secretary.yaml",
+			content: "frequency: often\n",
+			want:    []string{"secretary.yaml:1:", "often"},
+		},
+		{
+			name:    "secretary.yaml",
+			content: "secrets:\n  - name: DB\n    id: prod/db\n    modee: 0440\n    refresh: nope\n  - name: API\n    id: prod/api\n    refresh: -1m\n",
+			want:    []string{"secretary.yaml:4: field modee not found", "secretary.yaml:5:", "nope", "secretary.yaml:8: negative duration -1m"},
+		},
+		{
+			name: "secretary.yaml",
+			content: `secrets:
+  - name: DB
+    id: prod/db
+    mode: "0999"
+  - name: DB
+    id: prod/other
+  - name: 1PASSWORD
+    id: prod/password
+  - name: API
+    on_change: reload
+  - name: KEYED
+    id: arn:aws:secretsmanager:us-west-2:123456789012:secret:prod/db#password
+  - name: OPTIONS
+    id: vault://secret/data/app?mode=0400
+`,
+			want: []string{
+				"secretary.yaml:2: secret DB: invalid mode",
+				"secretary.yaml:5: duplicate secret DB, first declared at",
+				"secretary.yaml:7: invalid secret name",
+				"secretary.yaml:9: secret API: id is required",
+				"secretary.yaml:11: secret KEYED: id \"arn:aws:secretsmanager:us-west-2:123456789012:secret:prod/db#password\" must not contain # or ?",
+				"secretary.yaml:13: secret OPTIONS: id \"vault://secret/data/app?mode=0400\" must not contain # or ?",
+			},
+		},
+		{
+			name:    "secretary.toml",
+			content: "[[secrets]]\nname = \"DB\"\nid = \"prod/db\"\nformat = \"hex\"\n",
+			want:    []string{"secretary.toml:1: secret DB: invalid format"},
+		},
+		{
+			name:    "secretary.toml",
+			content: "provider = \"aws\"\nretries = 3\n",
+			want:    []string{"secretary.toml:2: unknown field retries"},
+		},
+		{
+			name:    "secretary.toml",
+			content: "[[secrets]]\nname = \"DB\"\nid = \"prod/db\"\nuid = \"root\"\n",
+			want:    []string{"secretary.toml:4:"},
+		},
+		{
+			name:    "secretary.json",
+			content: "{}",
+			want:    []string{"unsupported configuration file"},
+		},
+	}
+	for _, tt := range tests {
+		_, err := Load(writeConfig(t, tt.name, tt.content))
+		if err == nil {
+			t.Errorf("%s: expected an error for %q", tt.name, tt.content)
+			continue
+		}
+		// Errors name the file by the path it was loaded from.
+		msg := err.Error()
+		for _, want := range tt.want {
+			if !strings.Contains(msg, want) {
+				t.Errorf("%s: expected the error to contain %q, got %q", tt.name, want, msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package health serves the liveness, readiness and status endpoints of secretary.
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/metrics"
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+)
+
+// Server reports the health of secretary and the application it supervises over HTTP:
+//
+//   - /healthz succeeds while the application is running.
+//   - /readyz succeeds once every secret was retrieved and none was last checked with
+//     the provider longer than the maximum staleness ago, or for secrets with a refresh
+//     interval, longer than the interval plus the watcher's frequency ago.
+//   - /status describes every secret as JSON, without its value.
+//   - /metrics serves the Prometheus metrics.
+type Server struct {
+	retriever    *secretmanager.Retriever
+	alive        func() bool
+	maxStaleness time.Duration
+	frequency    time.Duration
+	started      atomic.Bool
+}
+
+// Option is a function that modifies a Server.
+type Option func(*Server)
+
+// WithAlive sets the function reporting whether the application is running.
+func WithAlive(alive func() bool) Option {
+	return func(s *Server) {
+		s.alive = alive
+	}
+}
+
+// WithMaxStaleness sets how long ago a secret may have last been checked with its provider
+// for secretary to remain ready. Zero disables the check.
+func WithMaxStaleness(d time.Duration) Option {
+	return func(s *Server) {
+		s.maxStaleness = d
+	}
+}
+
+// WithFrequency sets how often the watcher checks secrets, so that a secret with a refresh
+// interval is given until one check after it is due before secretary stops being ready.
+func WithFrequency(d time.Duration) Option {
+	return func(s *Server) {
+		s.frequency = d
+	}
+}
+
+// New creates a Server reporting the secrets of the retriever.
+func New(retriever *secretmanager.Retriever, opts ...Option) *Server {
+	s := &Server{
+		retriever: retriever,
+		alive:     func() bool { return false },
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// MarkStarted records that all secrets were retrieved at startup.
+// Secretary is not ready before.
+func (s *Server) MarkStarted() {
+	s.started.Store(true)
+}
+
+// Status is the document served on /status.
+type Status struct {
+	Started    bool                         `json:"started"`
+	Ready      bool                         `json:"ready"`
+	Degraded   bool                         `json:"degraded"`
+	ChildAlive bool                         `json:"child_alive"`
+	Error      string                       `json:"error,omitempty"`
+	Secrets    []secretmanager.SecretStatus `json:"secrets"`
+}
+
+// ready reports why secretary is not ready, or nil when it is.
+func (s *Server) ready(secrets []secretmanager.SecretStatus) error {
+	if !s.started.Load() {
+		return errors.New("secrets are still being retrieved")
+	}
+	for _, secret := range secrets {
+		if secret.LastChecked.IsZero() {
+			return fmt.Errorf("secret %s was never retrieved", secret.EnvName)
+		}
+		staleness := s.maxStaleness
+		if secret.Refresh > 0 {
+			staleness = max(staleness, secret.Refresh+s.frequency)
+		}
+		if age := time.Since(secret.LastChecked); s.maxStaleness > 0 && age > staleness {
+			return fmt.Errorf("secret %s was last checked %s ago", secret.EnvName, age.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// Handler returns the HTTP handler serving the health endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !s.alive() {
+			http.Error(w, "application is not running", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.ready(s.retriever.Status()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok\n")
+	})
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		secrets := s.retriever.Status()
+		status := Status{
+			Started:    s.started.Load(),
+			Degraded:   s.retriever.Degraded(),
+			ChildAlive: s.alive(),
+			Secrets:    secrets,
+		}
+		if err := s.ready(secrets); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Ready = true
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(status); err != nil {
+			slog.Error("Error writing status", logging.Err(err))
+		}
+	})
+	return mux
+}
+
+// ListenAndServe serves the health endpoints on addr until ctx is cancelled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+	slog.Info("Serving health endpoints", "addr", l.Addr().String())
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Check queries the readiness endpoint of a secretary listening on addr and returns an error
+// unless it is ready. A missing host in addr is taken to mean the local host.
+func Check(ctx context.Context, addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+net.JoinHostPort(host, port)+"/readyz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("not ready: %s", bytes.TrimSpace(body))
+	}
+	return nil
+}
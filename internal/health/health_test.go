@@ -0,0 +1,147 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/providers/dummy"
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+)
+
+func newRetriever(t *testing.T) *secretmanager.Retriever {
+	t.Helper()
+	r := secretmanager.NewRetriever(dummy.NewSecretManager(), secretmanager.WithPath(t.TempDir()))
+	t.Cleanup(func() { r.Clean() })
+	if err := r.CreateSecretsFromEnvironment(context.Background(), []string{"SECRETARY_HEALTH_DB=dummy://db"}); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+	return r
+}
+
+func get(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestHealthz(t *testing.T) {
+	alive := false
+	s := New(newRetriever(t), WithAlive(func() bool { return alive }))
+	h := s.Handler()
+
+	if rec := get(t, h, "/healthz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the application runs, got %d", rec.Code)
+	}
+	alive = true
+	if rec := get(t, h, "/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 while the application runs, got %d", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	s := New(newRetriever(t), WithMaxStaleness(time.Hour))
+	h := s.Handler()
+
+	if rec := get(t, h, "/readyz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before startup completed, got %d", rec.Code)
+	}
+	s.MarkStarted()
+	if rec := get(t, h, "/readyz"); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 once started, got %d: %s", rec.Code, rec.Body)
+	}
+
+	s.maxStaleness = time.Nanosecond
+	rec := get(t, h, "/readyz")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "HEALTH_DB") {
+		t.Errorf("Expected 503 naming the stale secret, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestReadyHonoursRefresh(t *testing.T) {
+	s := New(nil, WithMaxStaleness(4*time.Second), WithFrequency(time.Second))
+	s.MarkStarted()
+	checked := time.Now().Add(-time.Minute)
+
+	secrets := []secretmanager.SecretStatus{{EnvName: "HOURLY", LastChecked: checked, Refresh: time.Hour}}
+	if err := s.ready(secrets); err != nil {
+		t.Errorf("Expected a secret refreshed hourly to be current a minute after its check, got %v", err)
+	}
+	secrets[0].LastChecked = time.Now().Add(-time.Hour - 2*time.Second)
+	if err := s.ready(secrets); err == nil || !strings.Contains(err.Error(), "HOURLY") {
+		t.Errorf("Expected a secret overdue by more than one check to be stale, got %v", err)
+	}
+
+	secrets = []secretmanager.SecretStatus{{EnvName: "SHORT", LastChecked: time.Now().Add(-3 * time.Second), Refresh: time.Second}}
+	if err := s.ready(secrets); err != nil {
+		t.Errorf("Expected the maximum staleness to apply to short refresh intervals, got %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := New(newRetriever(t), WithAlive(func() bool { return true }))
+	s.MarkStarted()
+
+	rec := get(t, s.Handler(), "/status")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "dummy-secret-value") {
+		t.Fatal("Expected status not to contain secret values")
+	}
+	var status Status
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if !status.Ready || !status.ChildAlive || status.Degraded {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if len(status.Secrets) != 1 {
+		t.Fatalf("Expected 1 secret, got %d", len(status.Secrets))
+	}
+	secret := status.Secrets[0]
+	if secret.EnvName != "HEALTH_DB" || secret.Identifier != "dummy://db" || secret.Version == "" || secret.LastChecked.IsZero() {
+		t.Errorf("Unexpected secret status %+v", secret)
+	}
+}
+
+func TestStatusRefreshInterval(t *testing.T) {
+	r := secretmanager.NewRetriever(dummy.NewSecretManager(), secretmanager.WithPath(t.TempDir()))
+	t.Cleanup(func() { r.Clean() })
+	if err := r.CreateSecretsFromEnvironment(context.Background(), []string{"SECRETARY_HOURLY=dummy://db?refresh=1h"}); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+	s := New(r)
+
+	rec := get(t, s.Handler(), "/status")
+	if !strings.Contains(rec.Body.String(), `"refresh": "1h0m0s"`) {
+		t.Errorf("Expected the refresh interval as a duration string, got %s", rec.Body)
+	}
+	var status Status
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(status.Secrets) != 1 || status.Secrets[0].Refresh != time.Hour {
+		t.Errorf("Expected the refresh interval to decode to 1h, got %+v", status.Secrets)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	s := New(newRetriever(t))
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	if err := Check(context.Background(), addr); err == nil {
+		t.Error("Expected Check to fail before startup completed")
+	}
+	s.MarkStarted()
+	if err := Check(context.Background(), addr); err != nil {
+		t.Errorf("Expected Check to succeed, got %v", err)
+	}
+}
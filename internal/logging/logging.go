@@ -0,0 +1,132 @@
+// Package logging configures structured logging and guarantees that secret values never reach
+// a log record.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fr0stylo/secretary/internal/redact"
+)
+
+// Keys of the fields shared by secretary log records.
+const (
+	Provider   = "provider"
+	Identifier = "identifier"
+	EnvName    = "env_name"
+	Version    = "version"
+	Duration   = "duration"
+	Error      = "error"
+	Template   = "template"
+	Path       = "path"
+)
+
+// Err returns the field describing an error. A nil error yields an empty field, which handlers omit.
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.Any(Error, err)
+}
+
+// Debug reports whether debug logging is requested with SECRETARY_DEBUG.
+func Debug() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("SECRETARY_DEBUG"))
+	return enabled
+}
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// New creates a logger writing records of at least the given level to w, formatted as text
+// or json. Every record is redacted with set.
+func New(w io.Writer, format string, level slog.Leveler, set *redact.Set) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return slog.New(NewRedactingHandler(h, set)), nil
+}
+
+// redactingHandler masks the values of a redact.Set in the message and fields of every record
+// before passing it on.
+type redactingHandler struct {
+	next slog.Handler
+	set  *redact.Set
+}
+
+// NewRedactingHandler returns a handler masking the values of set in every record before
+// passing it to next. Errors and other values are masked in their string form.
+func NewRedactingHandler(next slog.Handler, set *redact.Set) slog.Handler {
+	return &redactingHandler{next: next, set: set}
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, h.set.String(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+// WithAttrs masks attrs when they are attached, which is enough for fields describing where
+// a record comes from. Secret values should never be attached to a logger.
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.attr(a)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(redacted), set: h.set}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name), set: h.set}
+}
+
+// attr masks the value of a field, converting it to a string when it is not one.
+func (h *redactingHandler) attr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(h.set.String(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redacted[i] = h.attr(ga)
+		}
+		a.Value = slog.GroupValue(redacted...)
+	case slog.KindAny:
+		if b, ok := a.Value.Any().([]byte); ok {
+			a.Value = slog.StringValue(h.set.String(string(b)))
+			break
+		}
+		str := fmt.Sprint(a.Value.Any())
+		if masked := h.set.String(str); masked != str {
+			a.Value = slog.StringValue(masked)
+		}
+	}
+	return a
+}
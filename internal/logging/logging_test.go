@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/fr0stylo/secretary/internal/redact"
+)
+
+const secret = "correct-horse-battery-staple"
+
+func newTestLogger(t *testing.T, format string) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+	set := redact.New()
+	set.Put("id", []byte(secret))
+	var buf bytes.Buffer
+	logger, err := New(&buf, format, slog.LevelDebug, set)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return logger, &buf
+}
+
+func TestRedactsEveryPartOfARecord(t *testing.T) {
+	for _, format := range []string{"text", "json"} {
+		t.Run(format, func(t *testing.T) {
+			logger, buf := newTestLogger(t, format)
+
+			logger.Info("value is "+secret, "field", secret)
+			logger.Error("failed", Err(fmt.Errorf("parsing %q: %w", secret, errors.New("boom"))))
+			logger.Debug("bytes", "value", []byte(secret))
+			logger.Warn("grouped", slog.Group("secret", slog.String("value", secret)))
+			logger.With("attached", secret).WithGroup("g").Info("with", "nested", []string{secret})
+			logger.Info("valuer", "lazy", slog.AnyValue(struct{ V string }{secret}))
+
+			if strings.Contains(buf.String(), secret) {
+				t.Errorf("Secret value reached the log:\n%s", buf)
+			}
+			if got := strings.Count(buf.String(), redact.Mask); got != 8 {
+				t.Errorf("Expected 8 masked values, got %d:\n%s", got, buf)
+			}
+		})
+	}
+}
+
+func TestJSONFields(t *testing.T) {
+	logger, buf := newTestLogger(t, "json")
+	logger.Info("Creating secret", Identifier, "prod/db", EnvName, "DB_PASSWORD", Version, "v2")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Invalid JSON record %q: %v", buf, err)
+	}
+	for key, want := range map[string]string{"msg": "Creating secret", Identifier: "prod/db", EnvName: "DB_PASSWORD", Version: "v2", "level": "INFO"} {
+		if record[key] != want {
+			t.Errorf("Expected %s = %q, got %v", key, want, record[key])
+		}
+	}
+}
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "text", slog.LevelWarn, redact.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("Unexpected output for level warn:\n%s", buf.String())
+	}
+	if logger.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("Expected info to be disabled")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError}
+	for name, want := range tests {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+	if _, err := New(&bytes.Buffer{}, "xml", slog.LevelInfo, redact.New()); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestDebug(t *testing.T) {
+	for value, want := range map[string]bool{"": false, "true": true, "1": true, "false": false, "yes": false} {
+		t.Setenv("SECRETARY_DEBUG", value)
+		if got := Debug(); got != want {
+			t.Errorf("Debug() with SECRETARY_DEBUG=%q = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestErrOmitsNil(t *testing.T) {
+	logger, buf := newTestLogger(t, "json")
+	logger.Info("done", Err(nil))
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Invalid JSON record %q: %v", buf, err)
+	}
+	if _, ok := record[Error]; ok {
+		t.Errorf("Expected no error field, got %v", record)
+	}
+}
@@ -0,0 +1,194 @@
+// Package metrics exposes Prometheus metrics about secret retrieval, rotation and the supervised application.
+package metrics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// Registry holds every secretary metric, along with the Go runtime and process collectors.
+	Registry = prometheus.NewRegistry()
+
+	// ProviderRequests counts provider calls by provider, operation and outcome.
+	ProviderRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secretary_provider_requests_total",
+		Help: "Number of calls made to secret providers.",
+	}, []string{"provider", "operation", "outcome"})
+
+	// ProviderLatency observes the duration of provider calls by provider and operation.
+	ProviderLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "secretary_provider_request_duration_seconds",
+		Help:    "Duration of calls made to secret providers.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"provider", "operation"})
+
+	// VersionCheckErrors counts failed version checks by hashed secret identifier.
+	VersionCheckErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secretary_version_check_errors_total",
+		Help: "Number of failed secret version checks, by hashed secret identifier.",
+	}, []string{"identifier"})
+
+	// Rotations counts detected secret rotations by hashed secret identifier.
+	Rotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secretary_rotations_total",
+		Help: "Number of detected secret rotations, by hashed secret identifier.",
+	}, []string{"identifier"})
+
+	// LastRefresh is the time of the last check that reached the provider for every secret.
+	LastRefresh = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "secretary_last_successful_refresh_timestamp_seconds",
+		Help: "Unix time of the last successful check of all secrets.",
+	})
+
+	// ChildRestarts counts restarts of the supervised application.
+	ChildRestarts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "secretary_child_restarts_total",
+		Help: "Number of restarts of the supervised application.",
+	})
+
+	// SignalsSent counts signals delivered to the supervised application by signal name.
+	SignalsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "secretary_signals_sent_total",
+		Help: "Number of signals sent to the supervised application.",
+	}, []string{"signal"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ProviderRequests,
+		ProviderLatency,
+		VersionCheckErrors,
+		Rotations,
+		LastRefresh,
+		ChildRestarts,
+		SignalsSent,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// HashIdentifier returns a short, stable hash of a secret identifier for use as a label value,
+// so that metrics do not reveal the names of secrets.
+func HashIdentifier(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Client is the secretmanager.Client interface, repeated here so that the secretmanager
+// package can record metrics without an import cycle.
+type Client interface {
+	GetSecretValue(ctx context.Context, id string) ([]byte, error)
+	GetSecretVersion(ctx context.Context, id string) (string, error)
+}
+
+// batchVersioner is the secretmanager.BatchVersioner interface.
+type batchVersioner interface {
+	GetSecretVersions(ctx context.Context, ids []string) (map[string]string, error)
+}
+
+// validator is the secretmanager.Validator interface.
+type validator interface {
+	ValidateIdentifier(id string) error
+}
+
+// Wrap returns a client that records the count, outcome and latency of every call made to
+// client under the given provider name, names the provider on the span of each call and logs
+// it at debug level.
+// Batch version lookups and identifier validation are passed through when client supports them.
+func Wrap(provider string, client Client) Client {
+	i := &instrumented{provider: provider, client: client}
+	_, batch := client.(batchVersioner)
+	_, valid := client.(validator)
+	switch {
+	case batch && valid:
+		return struct {
+			*instrumented
+			validator
+		}{i, client.(validator)}
+	case batch:
+		return i
+	case valid:
+		return struct {
+			Client
+			validator
+		}{plain{i}, client.(validator)}
+	}
+	return plain{i}
+}
+
+// instrumented records metrics for the calls made to a client.
+type instrumented struct {
+	provider string
+	client   Client
+}
+
+// observe records a call in the metrics and the log, and names the provider on the span of the call.
+func (i *instrumented) observe(ctx context.Context, operation string, id slog.Attr, start time.Time, err error) {
+	duration := time.Since(start)
+	trace.SpanFromContext(ctx).SetAttributes(tracing.Provider.String(i.provider))
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	ProviderRequests.WithLabelValues(i.provider, operation, outcome).Inc()
+	ProviderLatency.WithLabelValues(i.provider, operation).Observe(duration.Seconds())
+	slog.DebugContext(ctx, "Provider call",
+		logging.Provider, i.provider,
+		"operation", operation,
+		id,
+		logging.Duration, duration,
+		"outcome", outcome,
+		logging.Err(err),
+	)
+}
+
+func (i *instrumented) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	start := time.Now()
+	value, err := i.client.GetSecretValue(ctx, id)
+	i.observe(ctx, "get_value", slog.String(logging.Identifier, id), start, err)
+	return value, err
+}
+
+func (i *instrumented) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	start := time.Now()
+	version, err := i.client.GetSecretVersion(ctx, id)
+	i.observe(ctx, "get_version", slog.String(logging.Identifier, id), start, err)
+	return version, err
+}
+
+func (i *instrumented) GetSecretVersions(ctx context.Context, ids []string) (map[string]string, error) {
+	start := time.Now()
+	versions, err := i.client.(batchVersioner).GetSecretVersions(ctx, ids)
+	i.observe(ctx, "get_versions", slog.Int("identifiers", len(ids)), start, err)
+	return versions, err
+}
+
+// plain hides the batch method of instrumented for clients that do not support batching.
+type plain struct {
+	i *instrumented
+}
+
+func (p plain) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	return p.i.GetSecretValue(ctx, id)
+}
+
+func (p plain) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	return p.i.GetSecretVersion(ctx, id)
+}
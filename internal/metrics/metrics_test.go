@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeClient struct{}
+
+func (fakeClient) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	if id == "missing" {
+		return nil, errors.New("not found")
+	}
+	return []byte("value"), nil
+}
+
+func (fakeClient) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	return "v1", nil
+}
+
+type fakeBatchClient struct{ fakeClient }
+
+func (fakeBatchClient) GetSecretVersions(ctx context.Context, ids []string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+type fakeValidatingClient struct{ fakeClient }
+
+func (fakeValidatingClient) ValidateIdentifier(id string) error { return nil }
+
+type fakeFullClient struct{ fakeBatchClient }
+
+func (fakeFullClient) ValidateIdentifier(id string) error { return nil }
+
+func TestWrapRecordsCalls(t *testing.T) {
+	ProviderRequests.Reset()
+	c := Wrap("fake", fakeClient{})
+	c.GetSecretValue(context.Background(), "id")
+	c.GetSecretValue(context.Background(), "missing")
+	c.GetSecretVersion(context.Background(), "id")
+
+	if got := testutil.ToFloat64(ProviderRequests.WithLabelValues("fake", "get_value", "success")); got != 1 {
+		t.Errorf("Expected 1 successful get_value, got %v", got)
+	}
+	if got := testutil.ToFloat64(ProviderRequests.WithLabelValues("fake", "get_value", "error")); got != 1 {
+		t.Errorf("Expected 1 failed get_value, got %v", got)
+	}
+	if got := testutil.ToFloat64(ProviderRequests.WithLabelValues("fake", "get_version", "success")); got != 1 {
+		t.Errorf("Expected 1 successful get_version, got %v", got)
+	}
+	if got := testutil.CollectAndCount(ProviderLatency, "secretary_provider_request_duration_seconds"); got == 0 {
+		t.Error("Expected latency to be observed")
+	}
+}
+
+func TestWrapPreservesOptionalInterfaces(t *testing.T) {
+	tests := []struct {
+		client      Client
+		batch, vali bool
+	}{
+		{fakeClient{}, false, false},
+		{fakeBatchClient{}, true, false},
+		{fakeValidatingClient{}, false, true},
+		{fakeFullClient{}, true, true},
+	}
+	for _, tt := range tests {
+		c := Wrap("fake", tt.client)
+		if _, ok := c.(batchVersioner); ok != tt.batch {
+			t.Errorf("%T: expected batch support %v, got %v", tt.client, tt.batch, ok)
+		}
+		if _, ok := c.(validator); ok != tt.vali {
+			t.Errorf("%T: expected validation support %v, got %v", tt.client, tt.vali, ok)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ChildRestarts.Inc()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "secretary_child_restarts_total") {
+		t.Errorf("Expected metrics output, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHashIdentifier(t *testing.T) {
+	id := "arn:aws:secretsmanager:us-west-2:123456789012:secret:prod/db"
+	if h := HashIdentifier(id); h != HashIdentifier(id) || strings.Contains(h, "prod") || len(h) != 12 {
+		t.Errorf("Unexpected hash %q", h)
+	}
+}
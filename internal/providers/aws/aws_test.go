@@ -0,0 +1,193 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const testARN = "arn:aws:secretsmanager:us-west-2:123456789012:secret:"
+
+func TestMatchesSecret(t *testing.T) {
+	tests := []struct {
+		id, arn, name string
+		want          bool
+	}{
+		{id: testARN + "prod/db-AbCdEf", arn: testARN + "prod/db-AbCdEf", name: "prod/db", want: true},
+		{id: "prod/db", arn: testARN + "prod/db-AbCdEf", name: "prod/db", want: true},
+		{id: testARN + "prod/db", arn: testARN + "prod/db-AbCdEf", name: "prod/db", want: true},
+		{id: testARN + "prod/db", arn: testARN + "prod/db-old-AbCdEf", name: "prod/db-old", want: false},
+		{id: "prod/db", arn: testARN + "prod/db-old-AbCdEf", name: "prod/db-old", want: false},
+		{id: testARN + "prod/db-old", arn: testARN + "prod/db-AbCdEf", name: "prod/db", want: false},
+		{id: testARN + "prod/db", arn: testARN + "prod/db-AbCdE", name: "prod/db", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchesSecret(tt.id, tt.arn, tt.name); got != tt.want {
+			t.Errorf("matchesSecret(%q, %q, %q) = %t, expected %t", tt.id, tt.arn, tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeSecretsManager serves BatchGetSecretValue from a fixed set of secrets, at most pageSize per page.
+type fakeSecretsManager struct {
+	secretsManagerAPI
+	secrets  map[string]string // name to version
+	pageSize int
+	calls    []string // batch size and page token of each call
+	err      error    // returned by every call when set
+}
+
+func (f *fakeSecretsManager) BatchGetSecretValue(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+	f.calls = append(f.calls, fmt.Sprintf("%d@%s", len(params.SecretIdList), aws.ToString(params.NextToken)))
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(params.SecretIdList) > maxSecretIDs {
+		return nil, fmt.Errorf("too many secrets: %d", len(params.SecretIdList))
+	}
+	start := 0
+	if params.NextToken != nil {
+		fmt.Sscan(*params.NextToken, &start)
+	}
+	out := &secretsmanager.BatchGetSecretValueOutput{}
+	end := min(start+f.pageSize, len(params.SecretIdList))
+	for _, id := range params.SecretIdList[start:end] {
+		name := strings.TrimPrefix(id, testARN)
+		version, ok := f.secrets[name]
+		if !ok {
+			out.Errors = append(out.Errors, smtypes.APIErrorType{SecretId: aws.String(id), ErrorCode: aws.String("ResourceNotFoundException"), Message: aws.String("not found")})
+			continue
+		}
+		out.SecretValues = append(out.SecretValues, smtypes.SecretValueEntry{
+			ARN:       aws.String(testARN + name + "-AbCdEf"),
+			Name:      aws.String(name),
+			VersionId: aws.String(version),
+		})
+	}
+	if end < len(params.SecretIdList) {
+		out.NextToken = aws.String(fmt.Sprint(end))
+	}
+	return out, nil
+}
+
+func TestSecretsManagerGetSecretVersions(t *testing.T) {
+	fake := &fakeSecretsManager{secrets: make(map[string]string), pageSize: 7}
+	var ids []string
+	for i := range 25 {
+		id := fmt.Sprintf("prod/app-%02d", i)
+		fake.secrets[id] = fmt.Sprintf("v%d", i)
+		ids = append(ids, id)
+	}
+	// A partial ARN and a secret whose name extends it, requested in the same batch.
+	fake.secrets["prod/db"] = "db-v1"
+	fake.secrets["prod/db-old"] = "db-old-v1"
+	ids = append(ids, testARN+"prod/db", "prod/db-old", "prod/missing")
+
+	versions, err := (&SecretsManager{client: fake}).GetSecretVersions(context.Background(), ids)
+	if err == nil || !strings.Contains(err.Error(), "prod/missing: ResourceNotFoundException") {
+		t.Errorf("Expected an error for the missing secret, got %v", err)
+	}
+	if len(versions) != len(ids)-1 {
+		t.Errorf("Expected %d versions, got %d", len(ids)-1, len(versions))
+	}
+	for i := range 25 {
+		id := fmt.Sprintf("prod/app-%02d", i)
+		if want := fmt.Sprintf("v%d", i); versions[id] != want {
+			t.Errorf("Expected %s at version %s, got %q", id, want, versions[id])
+		}
+	}
+	if versions[testARN+"prod/db"] != "db-v1" || versions["prod/db-old"] != "db-old-v1" {
+		t.Errorf("Expected prod/db and prod/db-old to keep their own versions, got %q and %q", versions[testARN+"prod/db"], versions["prod/db-old"])
+	}
+
+	// 28 secrets are requested in batches of 20 and 8, each paged 7 at a time.
+	if want := []string{"20@", "20@7", "20@14", "8@", "8@7"}; !slices.Equal(fake.calls, want) {
+		t.Errorf("Expected calls %v, got %v", want, fake.calls)
+	}
+}
+
+// apiError is an AWS error response with the given code.
+type apiError struct {
+	code string
+}
+
+func (e apiError) Error() string     { return e.code }
+func (e apiError) ErrorCode() string { return e.code }
+
+func TestSecretsManagerBatchDenied(t *testing.T) {
+	fake := &fakeSecretsManager{err: apiError{"ThrottlingException"}}
+	sm := &SecretsManager{client: fake}
+	if _, err := sm.GetSecretVersions(context.Background(), []string{"prod/db"}); err == nil || errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Expected throttling to be reported as is, got %v", err)
+	}
+
+	// Without the permission, versions are looked up one by one, and the batch is not tried again.
+	fake.err = apiError{"AccessDeniedException"}
+	for range 2 {
+		if _, err := sm.GetSecretVersions(context.Background(), []string{"prod/db"}); !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("Expected access denied to be unsupported, got %v", err)
+		}
+	}
+	if len(fake.calls) != 2 {
+		t.Errorf("Expected the batch not to be tried once denied, got calls %v", fake.calls)
+	}
+}
+
+// fakeSSM serves GetParameters from a fixed set of parameters.
+type fakeSSM struct {
+	ssmAPI
+	parameters map[string]int64
+	calls      [][]string
+}
+
+func (f *fakeSSM) GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	f.calls = append(f.calls, params.Names)
+	if len(params.Names) > maxParameters {
+		return nil, fmt.Errorf("too many names: %d", len(params.Names))
+	}
+	out := &ssm.GetParametersOutput{}
+	for _, name := range params.Names {
+		version, ok := f.parameters[name]
+		if !ok {
+			out.InvalidParameters = append(out.InvalidParameters, name)
+			continue
+		}
+		out.Parameters = append(out.Parameters, ssmtypes.Parameter{Name: aws.String(name), Version: version})
+	}
+	return out, nil
+}
+
+func TestSSMGetSecretVersions(t *testing.T) {
+	fake := &fakeSSM{parameters: make(map[string]int64)}
+	var ids []string
+	for i := range 22 {
+		name := fmt.Sprintf("/prod/app/%02d", i)
+		fake.parameters[name] = int64(i + 1)
+		ids = append(ids, name)
+	}
+	ids = append(ids, "/prod/missing")
+
+	versions, err := (&Ssm{client: fake}).GetSecretVersions(context.Background(), ids)
+	if err == nil || !strings.Contains(err.Error(), "/prod/missing: parameter not found") {
+		t.Errorf("Expected an error for the missing parameter, got %v", err)
+	}
+	if len(versions) != 22 || versions["/prod/app/00"] != "1" || versions["/prod/app/21"] != "22" {
+		t.Errorf("Unexpected versions %v", versions)
+	}
+	var sizes []int
+	for _, call := range fake.calls {
+		sizes = append(sizes, len(call))
+	}
+	if want := []int{10, 10, 3}; !slices.Equal(sizes, want) {
+		t.Errorf("Expected calls of %v names, got %v", want, sizes)
+	}
+}
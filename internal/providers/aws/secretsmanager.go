@@ -3,15 +3,33 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/secretmanager"
 )
 
 // SecretsManager implements the secretmanager.Client interface for AWS Secrets Manager.
 type SecretsManager struct {
-	client *secretsmanager.Client
+	client secretsManagerAPI
+	// batchDenied is set once BatchGetSecretValue was denied, so that versions are looked up
+	// one by one without trying the batch again.
+	batchDenied atomic.Bool
+}
+
+// secretsManagerAPI is the part of the Secrets Manager client used by SecretsManager.
+type secretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+	DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+	BatchGetSecretValue(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error)
 }
 
 // GetSecretValue retrieves the value of a secret from AWS Secrets Manager.
@@ -44,9 +62,85 @@ func (a *SecretsManager) GetSecretVersion(ctx context.Context, s string) (string
 	return "", fmt.Errorf("no current version found")
 }
 
+// maxSecretIDs is the largest number of secrets accepted by a single BatchGetSecretValue call.
+const maxSecretIDs = 20
+
+// GetSecretVersions retrieves the current versions of several secrets with BatchGetSecretValue,
+// requesting at most twenty secrets per call. Secrets may be identified by name, ARN or partial ARN.
+// When the batch call is rejected, for example without the secretsmanager:BatchGetSecretValue
+// permission, the error wraps errors.ErrUnsupported so that DescribeSecret is used instead.
+func (a *SecretsManager) GetSecretVersions(ctx context.Context, ids []string) (map[string]string, error) {
+	if a.batchDenied.Load() {
+		return nil, fmt.Errorf("secretsmanager:BatchGetSecretValue denied: %w", errors.ErrUnsupported)
+	}
+	versions := make(map[string]string, len(ids))
+	var errs []error
+	for batch := range slices.Chunk(ids, maxSecretIDs) {
+		input := &secretsmanager.BatchGetSecretValueInput{
+			SecretIdList: batch,
+		}
+		for {
+			out, err := a.client.BatchGetSecretValue(ctx, input)
+			if err != nil {
+				if err := batchError("secretsmanager:BatchGetSecretValue", err, &a.batchDenied); errors.Is(err, errors.ErrUnsupported) {
+					return nil, err
+				}
+				errs = append(errs, err)
+				break
+			}
+			for _, v := range out.SecretValues {
+				for _, id := range batch {
+					if matchesSecret(id, aws.ToString(v.ARN), aws.ToString(v.Name)) {
+						versions[id] = aws.ToString(v.VersionId)
+					}
+				}
+			}
+			for _, e := range out.Errors {
+				errs = append(errs, fmt.Errorf("%s: %s: %s", aws.ToString(e.SecretId), aws.ToString(e.ErrorCode), aws.ToString(e.Message)))
+			}
+			if out.NextToken == nil {
+				break
+			}
+			input.NextToken = out.NextToken
+		}
+	}
+	return versions, errors.Join(errs...)
+}
+
+// secretSuffixLen is the length of the random suffix AWS appends to secret ARNs, including the dash.
+const secretSuffixLen = len("-AbCdEf")
+
+// matchesSecret reports whether id refers to the secret with the given ARN and name.
+// Secret ARNs end with a random suffix, so a partial ARN without it matches too, but only when
+// exactly the suffix is missing: prod/db must not match the ARN of prod/db-old.
+func matchesSecret(id, secretARN, name string) bool {
+	if id == secretARN || id == name {
+		return true
+	}
+	return len(secretARN) == len(id)+secretSuffixLen && strings.HasPrefix(secretARN, id+"-")
+}
+
+// batchError returns the error of a failed batch call. An error response that is not transient,
+// such as access denied, wraps errors.ErrUnsupported so that versions are looked up one by one
+// instead. Access denied also sets denied, so that later checks skip the batch call.
+func batchError(action string, err error, denied *atomic.Bool) error {
+	var coded interface{ ErrorCode() string }
+	if !errors.As(err, &coded) || secretmanager.IsRetryable(err) {
+		return err
+	}
+	if coded.ErrorCode() == "AccessDeniedException" && !denied.Swap(true) {
+		slog.Warn("Batch version lookups are not permitted, looking up versions one by one", "action", action, logging.Err(err))
+	}
+	return fmt.Errorf("%s: %w: %w", action, errors.ErrUnsupported, err)
+}
+
+// withoutRetries disables the retries of the SDK, as provider calls are already retried by
+// secretary's retry policy and the attempts would otherwise multiply.
+var withoutRetries = config.WithRetryer(func() aws.Retryer { return aws.NopRetryer{} })
+
 // NewSecretsManager creates a new AWS Secrets Manager client.
 func NewSecretsManager(ctx context.Context) (*SecretsManager, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+	cfg, err := config.LoadDefaultConfig(ctx, withoutRetries)
 	if err != nil {
 		return nil, err
 	}
@@ -3,20 +3,33 @@ package aws
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sync/atomic"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
 // Ssm implements the secretmanager.Client interface for AWS Systems Manager Parameter Store.
 type Ssm struct {
-	client *ssm.Client
+	client ssmAPI
+	// batchDenied is set once GetParameters was denied, so that versions are looked up one by one
+	// without trying the batch again.
+	batchDenied atomic.Bool
+}
+
+// ssmAPI is the part of the Systems Manager client used by Ssm.
+type ssmAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+	GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
 }
 
 // GetSecretValue retrieves the value of a secret from AWS Systems Manager Parameter Store.
 // It takes a context and a parameter ID, and returns the parameter value as a byte slice.
-func (s Ssm) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+func (s *Ssm) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
 	p, err := s.client.GetParameter(ctx, &ssm.GetParameterInput{
 		Name: &id,
 	})
@@ -29,7 +42,7 @@ func (s Ssm) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
 
 // GetSecretVersion retrieves the current version of a parameter from AWS Systems Manager Parameter Store.
 // It takes a context and a parameter ID, and returns the parameter version as a string.
-func (s Ssm) GetSecretVersion(ctx context.Context, id string) (string, error) {
+func (s *Ssm) GetSecretVersion(ctx context.Context, id string) (string, error) {
 	p, err := s.client.GetParameter(ctx, &ssm.GetParameterInput{
 		Name: &id,
 	})
@@ -40,10 +53,48 @@ func (s Ssm) GetSecretVersion(ctx context.Context, id string) (string, error) {
 	return fmt.Sprintf("%d", p.Parameter.Version), nil
 }
 
+// maxParameters is the largest number of names accepted by a single GetParameters call.
+const maxParameters = 10
+
+// GetSecretVersions retrieves the current versions of several parameters with GetParameters,
+// requesting at most ten names per call. Parameters may be identified by name or ARN.
+// When the batch call is rejected, for example without the ssm:GetParameters permission, the error
+// wraps errors.ErrUnsupported so that GetParameter is used instead.
+func (s *Ssm) GetSecretVersions(ctx context.Context, ids []string) (map[string]string, error) {
+	if s.batchDenied.Load() {
+		return nil, fmt.Errorf("ssm:GetParameters denied: %w", errors.ErrUnsupported)
+	}
+	versions := make(map[string]string, len(ids))
+	var errs []error
+	for batch := range slices.Chunk(ids, maxParameters) {
+		out, err := s.client.GetParameters(ctx, &ssm.GetParametersInput{
+			Names: batch,
+		})
+		if err != nil {
+			if err := batchError("ssm:GetParameters", err, &s.batchDenied); errors.Is(err, errors.ErrUnsupported) {
+				return nil, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		for _, p := range out.Parameters {
+			for _, id := range batch {
+				if id == aws.ToString(p.Name) || id == aws.ToString(p.ARN) {
+					versions[id] = fmt.Sprintf("%d", p.Version)
+				}
+			}
+		}
+		for _, id := range out.InvalidParameters {
+			errs = append(errs, fmt.Errorf("%s: parameter not found", id))
+		}
+	}
+	return versions, errors.Join(errs...)
+}
+
 // NewSSM creates a new AWS Systems Manager Parameter Store client.
 // It initializes the client with default AWS configuration and returns a pointer to Ssm.
 func NewSSM(ctx context.Context) (*Ssm, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+	cfg, err := config.LoadDefaultConfig(ctx, withoutRetries)
 	if err != nil {
 		return nil, err
 	}
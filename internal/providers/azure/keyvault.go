@@ -0,0 +1,202 @@
+// Package azure provides Microsoft Azure implementations of secret management interfaces.
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// Scheme is the identifier prefix handled by the Azure Key Vault provider.
+const Scheme = "azkv://"
+
+const (
+	apiVersion = "7.4"
+	scope      = "https://vault.azure.net/.default"
+)
+
+// KeyVault implements the secretmanager.Client interface for Azure Key Vault secrets.
+// Identifiers take the form azkv://<vault-name>/<secret-name>[/<version>]. Without a version
+// the current version of the secret is used.
+type KeyVault struct {
+	credential azcore.TokenCredential
+	client     *http.Client
+	vaultURL   func(vault string) string
+}
+
+// Option is a function that modifies a KeyVault.
+type Option func(*KeyVault)
+
+// WithCredential sets the credential used to obtain access tokens instead of the default
+// chain of environment, workload identity and managed identity credentials.
+func WithCredential(credential azcore.TokenCredential) Option {
+	return func(k *KeyVault) {
+		k.credential = credential
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for Key Vault requests.
+func WithHTTPClient(client *http.Client) Option {
+	return func(k *KeyVault) {
+		k.client = client
+	}
+}
+
+// WithVaultURL sets how a vault name is turned into its base URL, for example for sovereign
+// clouds or a local stand-in. By default https://<vault-name>.vault.azure.net is used.
+func WithVaultURL(vaultURL func(vault string) string) Option {
+	return func(k *KeyVault) {
+		k.vaultURL = vaultURL
+	}
+}
+
+// ResponseError is returned when Key Vault answers with a non-successful status code.
+type ResponseError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("azure: unexpected status %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// HTTPStatusCode returns the status code of the Key Vault response, so that throttled requests (429)
+// and service errors are retried while Forbidden access policies (403) and missing secrets (404) are not.
+func (e *ResponseError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+type secretBundle struct {
+	Value      string `json:"value"`
+	ID         string `json:"id"`
+	Attributes struct {
+		Enabled *bool `json:"enabled"`
+	} `json:"attributes"`
+}
+
+// GetSecretValue retrieves the value of a Key Vault secret.
+func (k *KeyVault) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	bundle, err := k.getSecret(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(bundle.Value), nil
+}
+
+// GetSecretVersion retrieves the version ID of a Key Vault secret.
+// Key Vault has no metadata only lookup for the current version, so the secret bundle is fetched
+// and everything but the version taken from its ID is discarded.
+func (k *KeyVault) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	bundle, err := k.getSecret(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if bundle.ID == "" {
+		return "", fmt.Errorf("azure: no version found for %s", id)
+	}
+	return path.Base(bundle.ID), nil
+}
+
+func (k *KeyVault) getSecret(ctx context.Context, id string) (*secretBundle, error) {
+	vault, secretPath, err := parseIdentifier(id)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := k.credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{scope}})
+	if err != nil {
+		return nil, fmt.Errorf("azure: acquiring token: %w", err)
+	}
+
+	u := strings.TrimRight(k.vaultURL(vault), "/") + "/secrets/" + secretPath + "?api-version=" + apiVersion
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respErr := &ResponseError{StatusCode: resp.StatusCode}
+		var body struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil {
+			respErr.Code = body.Error.Code
+			respErr.Message = body.Error.Message
+		}
+		return nil, respErr
+	}
+
+	var bundle secretBundle
+	if err := json.NewDecoder(resp.Body).Decode(&bundle); err != nil {
+		return nil, err
+	}
+	if bundle.Attributes.Enabled != nil && !*bundle.Attributes.Enabled {
+		return nil, fmt.Errorf("azure: secret %s is disabled", id)
+	}
+	return &bundle, nil
+}
+
+// parseIdentifier splits an azkv:// identifier into the vault name and the secret path,
+// which is the secret name optionally followed by a version.
+func parseIdentifier(id string) (vault string, secretPath string, err error) {
+	rest, ok := strings.CutPrefix(id, Scheme)
+	if !ok {
+		return "", "", fmt.Errorf("azure: identifier %q does not start with %s", id, Scheme)
+	}
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", "", fmt.Errorf("azure: identifier %q must have the form %s<vault-name>/<secret-name>[/<version>]", id, Scheme)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return "", "", fmt.Errorf("azure: identifier %q has an empty path segment", id)
+		}
+	}
+	escaped := make([]string, 0, 2)
+	for _, part := range parts[1:] {
+		escaped = append(escaped, url.PathEscape(part))
+	}
+	return parts[0], strings.Join(escaped, "/"), nil
+}
+
+// NewKeyVault creates a new Azure Key Vault client. Unless a credential is provided, tokens are
+// obtained through the default Azure credential chain, which covers environment variables,
+// workload identity and managed identity.
+func NewKeyVault(ctx context.Context, opts ...Option) (*KeyVault, error) {
+	k := &KeyVault{
+		client: &http.Client{},
+		vaultURL: func(vault string) string {
+			return "https://" + vault + ".vault.azure.net"
+		},
+	}
+	for _, opt := range opts {
+		opt(k)
+	}
+	if k.credential == nil {
+		credential, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, fmt.Errorf("azure: creating default credential: %w", err)
+		}
+		k.credential = credential
+	}
+	return k, nil
+}
@@ -0,0 +1,114 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// staticCredential is an azcore.TokenCredential returning a fixed token.
+type staticCredential struct{}
+
+func (staticCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "test-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// newStandIn starts a local stand-in for the vault named my-vault holding db-password.
+func newStandIn(t *testing.T) *KeyVault {
+	t.Helper()
+	mux := http.NewServeMux()
+	bundle := func(version string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("api-version") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"value":"s3cr3t-%s","id":"https://my-vault.vault.azure.net/secrets/db-password/%s","attributes":{"enabled":true}}`, version, version)
+		}
+	}
+	mux.HandleFunc("GET /my-vault/secrets/db-password", bundle("4f1c2a"))
+	mux.HandleFunc("GET /my-vault/secrets/db-password/0a9b8c", bundle("0a9b8c"))
+	mux.HandleFunc("GET /my-vault/secrets/disabled", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"value":"x","id":"https://my-vault.vault.azure.net/secrets/disabled/1","attributes":{"enabled":false}}`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"error":{"code":"SecretNotFound","message":"A secret with (name/id) missing was not found in this key vault."}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	kv, err := NewKeyVault(context.Background(),
+		WithCredential(staticCredential{}),
+		WithHTTPClient(srv.Client()),
+		WithVaultURL(func(vault string) string { return srv.URL + "/" + vault }))
+	if err != nil {
+		t.Fatalf("NewKeyVault failed: %v", err)
+	}
+	return kv
+}
+
+func TestKeyVault(t *testing.T) {
+	kv := newStandIn(t)
+
+	version, err := kv.GetSecretVersion(context.Background(), "azkv://my-vault/db-password")
+	if err != nil {
+		t.Fatalf("GetSecretVersion failed: %v", err)
+	}
+	if version != "4f1c2a" {
+		t.Errorf("Expected version 4f1c2a, got %s", version)
+	}
+
+	value, err := kv.GetSecretValue(context.Background(), "azkv://my-vault/db-password")
+	if err != nil {
+		t.Fatalf("GetSecretValue failed: %v", err)
+	}
+	if string(value) != "s3cr3t-4f1c2a" {
+		t.Errorf("Unexpected value %s", value)
+	}
+
+	value, err = kv.GetSecretValue(context.Background(), "azkv://my-vault/db-password/0a9b8c")
+	if err != nil {
+		t.Fatalf("GetSecretValue failed: %v", err)
+	}
+	if string(value) != "s3cr3t-0a9b8c" {
+		t.Errorf("Expected the pinned version, got %s", value)
+	}
+}
+
+func TestKeyVaultErrors(t *testing.T) {
+	kv := newStandIn(t)
+
+	_, err := kv.GetSecretValue(context.Background(), "azkv://my-vault/missing")
+	respErr, ok := err.(*ResponseError)
+	if !ok || respErr.StatusCode != http.StatusNotFound || respErr.Code != "SecretNotFound" {
+		t.Errorf("Expected a SecretNotFound ResponseError, got %v", err)
+	}
+
+	if _, err := kv.GetSecretVersion(context.Background(), "azkv://my-vault/disabled"); err == nil {
+		t.Error("Expected an error for a disabled secret")
+	}
+}
+
+func TestParseIdentifier(t *testing.T) {
+	vault, secretPath, err := parseIdentifier("azkv://my-vault/db-password/0a9b8c")
+	if err != nil || vault != "my-vault" || secretPath != "db-password/0a9b8c" {
+		t.Errorf("Unexpected result %s %s %v", vault, secretPath, err)
+	}
+
+	for _, id := range []string{"azkv://my-vault", "azkv://my-vault//v1", "azkv://a/b/c/d", "gcp://projects/p/secrets/s"} {
+		if _, _, err := parseIdentifier(id); err == nil {
+			t.Errorf("%s: expected an error", id)
+		}
+	}
+}
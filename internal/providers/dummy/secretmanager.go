@@ -5,11 +5,16 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sync/atomic"
 )
 
+// Scheme is the identifier prefix handled by the dummy provider.
+const Scheme = "dummy://"
+
 // SecretManager implements the secretmanager.Client interface with dummy values for testing.
+// It is safe for concurrent use.
 type SecretManager struct {
-	version int
+	version atomic.Int64
 }
 
 // GetSecretValue returns a dummy secret value regardless of the provided ID.
@@ -21,16 +26,15 @@ func (s *SecretManager) GetSecretValue(ctx context.Context, id string) ([]byte,
 // GetSecretVersion returns a version string and occasionally increments the version.
 // It randomly increments the version (20% chance) to simulate version changes for testing.
 func (s *SecretManager) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	version := s.version.Load()
 	if rand.Int()%5 == 0 {
-		s.version++
+		version = s.version.Add(1)
 	}
-	return fmt.Sprintf("v%d", s.version), nil
+	return fmt.Sprintf("v%d", version), nil
 }
 
 // NewSecretManager creates a new dummy secret manager for testing purposes.
 // It initializes with version 0 and returns a pointer to SecretManager.
 func NewSecretManager() *SecretManager {
-	return &SecretManager{
-		version: 0,
-	}
+	return &SecretManager{}
 }
@@ -0,0 +1,27 @@
+package dummy
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestGetSecretVersionConcurrent(t *testing.T) {
+	s := NewSecretManager()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if _, err := s.GetSecretVersion(context.Background(), "dummy://db"); err != nil {
+					t.Errorf("GetSecretVersion failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if s.version.Load() == 0 {
+		t.Error("Expected the version to change over 800 lookups")
+	}
+}
@@ -0,0 +1,50 @@
+// Package file provides a local filesystem implementation of secret management interfaces.
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Scheme is the identifier prefix handled by the file provider.
+const Scheme = "file://"
+
+// SecretManager implements the secretmanager.Client interface for secrets stored in local files,
+// such as files mounted into a container by an orchestrator.
+type SecretManager struct{}
+
+// GetSecretValue reads the contents of the file named by a file:// identifier.
+func (s *SecretManager) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	p, err := parseIdentifier(id)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+// GetSecretVersion returns a digest of the file contents, so any change to the file is seen as a new version.
+func (s *SecretManager) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	value, err := s.GetSecretValue(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+func parseIdentifier(id string) (string, error) {
+	p, ok := strings.CutPrefix(id, Scheme)
+	if !ok || p == "" {
+		return "", fmt.Errorf("file: identifier %q must have the form %s<path>", id, Scheme)
+	}
+	return p, nil
+}
+
+// NewSecretManager creates a new file secret manager.
+func NewSecretManager() *SecretManager {
+	return &SecretManager{}
+}
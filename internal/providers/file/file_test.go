@@ -0,0 +1,56 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	if err := os.WriteFile(path, []byte(`{"password":"old"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	id := Scheme + path
+	s := NewSecretManager()
+	ctx := context.Background()
+
+	value, err := s.GetSecretValue(ctx, id)
+	if err != nil {
+		t.Fatalf("GetSecretValue failed: %v", err)
+	}
+	if string(value) != `{"password":"old"}` {
+		t.Errorf("Expected the file contents, got %q", value)
+	}
+	v1, err := s.GetSecretVersion(ctx, id)
+	if err != nil {
+		t.Fatalf("GetSecretVersion failed: %v", err)
+	}
+	if again, _ := s.GetSecretVersion(ctx, id); again != v1 {
+		t.Errorf("Expected an unchanged file to keep version %s, got %s", v1, again)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"password":"new"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := s.GetSecretVersion(ctx, id)
+	if err != nil {
+		t.Fatalf("GetSecretVersion failed: %v", err)
+	}
+	if v2 == v1 {
+		t.Errorf("Expected a rewritten file to get a new version, got %s twice", v1)
+	}
+}
+
+func TestSecretManagerErrors(t *testing.T) {
+	s := NewSecretManager()
+	for _, id := range []string{"file://", "/etc/passwd", "vault://secret/data/app"} {
+		if _, err := s.GetSecretValue(context.Background(), id); err == nil {
+			t.Errorf("%s: expected an invalid identifier error", id)
+		}
+	}
+	if _, err := s.GetSecretVersion(context.Background(), Scheme+filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error for a missing file, got %v", err)
+	}
+}
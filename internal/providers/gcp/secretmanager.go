@@ -0,0 +1,195 @@
+// Package gcp provides Google Cloud implementations of secret management interfaces.
+package gcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+// Scheme is the identifier prefix handled by the Google Cloud Secret Manager provider.
+const Scheme = "gcp://"
+
+const (
+	defaultEndpoint = "https://secretmanager.googleapis.com/v1/"
+	scope           = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// SecretManager implements the secretmanager.Client interface for Google Cloud Secret Manager.
+// Identifiers take the form gcp://projects/<project>/secrets/<secret>/versions/<version>, where the
+// version may be a number or latest. Without a version, latest is used.
+type SecretManager struct {
+	endpoint string
+	client   *http.Client
+}
+
+// Option is a function that modifies a SecretManager.
+type Option func(*SecretManager)
+
+// WithEndpoint overrides the Secret Manager API endpoint, for example to use a local fake server.
+func WithEndpoint(endpoint string) Option {
+	return func(s *SecretManager) {
+		s.endpoint = strings.TrimRight(endpoint, "/") + "/"
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for API requests instead of one authenticated
+// with Application Default Credentials.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *SecretManager) {
+		s.client = client
+	}
+}
+
+// ResponseError is returned when the Secret Manager API answers with a non-successful status code.
+type ResponseError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("gcp: unexpected status %d %s: %s", e.StatusCode, e.Status, e.Message)
+}
+
+// HTTPStatusCode returns the status code of the Secret Manager response. RESOURCE_EXHAUSTED quota
+// errors (429) and UNAVAILABLE (503) are retried, PERMISSION_DENIED (403) and NOT_FOUND (404) are not.
+func (e *ResponseError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// GetSecretValue retrieves the payload of a secret version and verifies its CRC32C checksum.
+func (s *SecretManager) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	name, err := parseIdentifier(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Payload struct {
+			Data       string `json:"data"`
+			DataCrc32c string `json:"dataCrc32c"`
+		} `json:"payload"`
+	}
+	if err := s.get(ctx, name+":access", &body); err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(body.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("gcp: decoding payload of %s: %w", id, err)
+	}
+	if body.Payload.DataCrc32c != "" {
+		want, err := strconv.ParseUint(body.Payload.DataCrc32c, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("gcp: invalid checksum for %s: %w", id, err)
+		}
+		if got := crc32.Checksum(data, castagnoli); uint64(got) != want {
+			return nil, fmt.Errorf("gcp: checksum mismatch for %s: payload is corrupted", id)
+		}
+	}
+	return data, nil
+}
+
+// GetSecretVersion resolves the secret version, turning aliases such as latest into the
+// concrete version number.
+func (s *SecretManager) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	name, err := parseIdentifier(id)
+	if err != nil {
+		return "", err
+	}
+
+	var body struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	}
+	if err := s.get(ctx, name, &body); err != nil {
+		return "", err
+	}
+	if body.State != "" && body.State != "ENABLED" {
+		return "", fmt.Errorf("gcp: version %s of %s is %s", path.Base(body.Name), id, body.State)
+	}
+	if body.Name == "" {
+		return "", fmt.Errorf("gcp: no version found for %s", id)
+	}
+	return path.Base(body.Name), nil
+}
+
+func (s *SecretManager) get(ctx context.Context, resource string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+resource, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respErr := &ResponseError{StatusCode: resp.StatusCode}
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+				Status  string `json:"status"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil {
+			respErr.Status = body.Error.Status
+			respErr.Message = body.Error.Message
+		}
+		return respErr
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// parseIdentifier converts a gcp:// identifier into the resource name of a secret version.
+func parseIdentifier(id string) (string, error) {
+	name, ok := strings.CutPrefix(id, Scheme)
+	if !ok {
+		return "", fmt.Errorf("gcp: identifier %q does not start with %s", id, Scheme)
+	}
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	switch {
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "secrets":
+		parts = append(parts, "versions", "latest")
+	case len(parts) == 6 && parts[0] == "projects" && parts[2] == "secrets" && parts[4] == "versions":
+	default:
+		return "", fmt.Errorf("gcp: identifier %q must have the form %sprojects/<project>/secrets/<secret>[/versions/<version>]", id, Scheme)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("gcp: identifier %q has an empty path segment", id)
+		}
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// NewSecretManager creates a new Google Cloud Secret Manager client. Unless an HTTP client is
+// provided, requests are authenticated with Application Default Credentials.
+func NewSecretManager(ctx context.Context, opts ...Option) (*SecretManager, error) {
+	s := &SecretManager{endpoint: defaultEndpoint}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.client == nil {
+		client, err := google.DefaultClient(ctx, scope)
+		if err != nil {
+			return nil, fmt.Errorf("gcp: loading application default credentials: %w", err)
+		}
+		s.client = client
+	}
+	return s, nil
+}
@@ -0,0 +1,112 @@
+package gcp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newFakeServer starts a local stand-in for the Secret Manager API serving version 5 of
+// projects/my-project/secrets/db-password as latest.
+func newFakeServer(t *testing.T, payload []byte, checksum uint32) *SecretManager {
+	t.Helper()
+	mux := http.NewServeMux()
+	version := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"name":"projects/123456/secrets/db-password/versions/5","state":"ENABLED"}`)
+	}
+	access := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"name":"projects/123456/secrets/db-password/versions/5","payload":{"data":%q,"dataCrc32c":"%d"}}`,
+			base64.StdEncoding.EncodeToString(payload), checksum)
+	}
+	mux.HandleFunc("GET /v1/projects/my-project/secrets/db-password/versions/latest", version)
+	mux.HandleFunc("GET /v1/projects/my-project/secrets/db-password/versions/5", version)
+	mux.HandleFunc("GET /v1/projects/my-project/secrets/db-password/versions/latest:access", access)
+	mux.HandleFunc("GET /v1/projects/my-project/secrets/disabled/versions/latest", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"name":"projects/123456/secrets/disabled/versions/2","state":"DISABLED"}`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"error":{"code":404,"message":"Secret not found","status":"NOT_FOUND"}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	sm, err := NewSecretManager(context.Background(), WithEndpoint(srv.URL+"/v1"), WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatalf("NewSecretManager failed: %v", err)
+	}
+	return sm
+}
+
+func TestSecretManager(t *testing.T) {
+	payload := []byte("s3cr3t")
+	sm := newFakeServer(t, payload, crc32.Checksum(payload, castagnoli))
+
+	for _, id := range []string{
+		"gcp://projects/my-project/secrets/db-password/versions/latest",
+		"gcp://projects/my-project/secrets/db-password",
+		"gcp://projects/my-project/secrets/db-password/versions/5",
+	} {
+		version, err := sm.GetSecretVersion(context.Background(), id)
+		if err != nil {
+			t.Fatalf("%s: GetSecretVersion failed: %v", id, err)
+		}
+		if version != "5" {
+			t.Errorf("%s: expected latest to resolve to version 5, got %s", id, version)
+		}
+	}
+
+	value, err := sm.GetSecretValue(context.Background(), "gcp://projects/my-project/secrets/db-password/versions/latest")
+	if err != nil {
+		t.Fatalf("GetSecretValue failed: %v", err)
+	}
+	if string(value) != "s3cr3t" {
+		t.Errorf("Expected s3cr3t, got %s", value)
+	}
+}
+
+func TestSecretManagerChecksumMismatch(t *testing.T) {
+	sm := newFakeServer(t, []byte("s3cr3t"), 42)
+
+	if _, err := sm.GetSecretValue(context.Background(), "gcp://projects/my-project/secrets/db-password"); err == nil {
+		t.Error("Expected a checksum mismatch error")
+	}
+}
+
+func TestSecretManagerErrors(t *testing.T) {
+	sm := newFakeServer(t, []byte("s3cr3t"), 0)
+
+	_, err := sm.GetSecretVersion(context.Background(), "gcp://projects/my-project/secrets/missing")
+	respErr, ok := err.(*ResponseError)
+	if !ok || respErr.StatusCode != http.StatusNotFound || respErr.Status != "NOT_FOUND" {
+		t.Errorf("Expected a NOT_FOUND ResponseError, got %v", err)
+	}
+
+	if _, err := sm.GetSecretVersion(context.Background(), "gcp://projects/my-project/secrets/disabled"); err == nil {
+		t.Error("Expected an error for a disabled version")
+	}
+}
+
+func TestParseIdentifier(t *testing.T) {
+	valid := map[string]string{
+		"gcp://projects/p/secrets/s/versions/latest": "projects/p/secrets/s/versions/latest",
+		"gcp://projects/p/secrets/s/versions/3":      "projects/p/secrets/s/versions/3",
+		"gcp://projects/p/secrets/s":                 "projects/p/secrets/s/versions/latest",
+	}
+	for id, want := range valid {
+		got, err := parseIdentifier(id)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s (%v)", id, want, got, err)
+		}
+	}
+
+	for _, id := range []string{"gcp://p/s", "gcp://projects/p/secrets", "gcp://projects//secrets/s", "vault://secret/data/s"} {
+		if _, err := parseIdentifier(id); err == nil {
+			t.Errorf("%s: expected an error", id)
+		}
+	}
+}
@@ -3,19 +3,137 @@ package providers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/fr0stylo/secretary/internal/providers/aws"
+	"github.com/fr0stylo/secretary/internal/providers/azure"
 	"github.com/fr0stylo/secretary/internal/providers/dummy"
+	"github.com/fr0stylo/secretary/internal/providers/file"
+	"github.com/fr0stylo/secretary/internal/providers/gcp"
+	"github.com/fr0stylo/secretary/internal/providers/vault"
 	"github.com/fr0stylo/secretary/internal/secretmanager"
 )
 
+// ErrUnsupportedScheme is returned for identifiers that do not match any registered scheme.
+var ErrUnsupportedScheme = errors.New("unsupported secret identifier")
+
+// Scheme maps a family of secret identifiers to the provider that serves them.
+type Scheme struct {
+	// Name identifies the provider. Clients are created once per name and reused.
+	Name string
+	// Pattern is the human readable form of the identifiers, used in error messages.
+	Pattern string
+	// Match reports whether the identifier belongs to this scheme.
+	Match func(id string) bool
+	// New creates the client for the provider.
+	New func(ctx context.Context) (secretmanager.Client, error)
+}
+
+// PrefixMatcher returns a Match function that accepts identifiers starting with prefix.
+func PrefixMatcher(prefix string) func(string) bool {
+	return func(id string) bool {
+		return strings.HasPrefix(id, prefix)
+	}
+}
+
+// ARNMatcher returns a Match function that accepts AWS ARNs of the given service in any partition.
+func ARNMatcher(service string) func(string) bool {
+	return func(id string) bool {
+		resource, err := arn.Parse(id)
+		return err == nil && resource.Service == service
+	}
+}
+
+// DefaultSchemes returns the schemes of all built-in providers.
+func DefaultSchemes() []Scheme {
+	return []Scheme{
+		{
+			Name:    "secretsmanager",
+			Pattern: "arn:aws:secretsmanager:*",
+			Match:   ARNMatcher("secretsmanager"),
+			New: func(ctx context.Context) (secretmanager.Client, error) {
+				return aws.NewSecretsManager(ctx)
+			},
+		},
+		{
+			Name:    "ssm",
+			Pattern: "arn:aws:ssm:*",
+			Match:   ARNMatcher("ssm"),
+			New: func(ctx context.Context) (secretmanager.Client, error) {
+				return aws.NewSSM(ctx)
+			},
+		},
+		{
+			Name:    "vault",
+			Pattern: vault.Scheme,
+			Match:   PrefixMatcher(vault.Scheme),
+			New: func(ctx context.Context) (secretmanager.Client, error) {
+				return vault.NewKV(ctx)
+			},
+		},
+		{
+			Name:    "gcp",
+			Pattern: gcp.Scheme,
+			Match:   PrefixMatcher(gcp.Scheme),
+			New: func(ctx context.Context) (secretmanager.Client, error) {
+				return gcp.NewSecretManager(ctx)
+			},
+		},
+		{
+			Name:    "azure",
+			Pattern: azure.Scheme,
+			Match:   PrefixMatcher(azure.Scheme),
+			New: func(ctx context.Context) (secretmanager.Client, error) {
+				return azure.NewKeyVault(ctx)
+			},
+		},
+		{
+			Name:    "file",
+			Pattern: file.Scheme,
+			Match:   PrefixMatcher(file.Scheme),
+			New: func(ctx context.Context) (secretmanager.Client, error) {
+				return file.NewSecretManager(), nil
+			},
+		},
+		{
+			Name:    "dummy",
+			Pattern: dummy.Scheme,
+			Match:   PrefixMatcher(dummy.Scheme),
+			New: func(ctx context.Context) (secretmanager.Client, error) {
+				return dummy.NewSecretManager(), nil
+			},
+		},
+	}
+}
+
+// Middleware wraps the client of a provider, for example to instrument it.
+type Middleware func(provider string, client secretmanager.Client) secretmanager.Client
+
+// Mux routes each secret identifier to the provider registered for its scheme.
 type Mux struct {
+	schemes    []Scheme
+	middleware []Middleware
+	// mu guards providers, as secrets are retrieved in parallel.
+	mu        sync.Mutex
 	providers map[string]secretmanager.Client
 }
 
+// Register adds a scheme to the mux. Schemes are matched in registration order.
+func (m *Mux) Register(s Scheme) {
+	m.schemes = append(m.schemes, s)
+}
+
+// Use adds a middleware wrapping every provider client when it is created, in the order added.
+func (m *Mux) Use(mw Middleware) {
+	m.middleware = append(m.middleware, mw)
+}
+
 func (m *Mux) withCache(provider string, retriever func() (secretmanager.Client, error)) (secretmanager.Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	p, ok := m.providers[provider]
 	var err error
 	if !ok {
@@ -29,29 +147,49 @@ func (m *Mux) withCache(provider string, retriever func() (secretmanager.Client,
 	return p, err
 }
 
-func (m *Mux) resolveProvider(id string) (secretmanager.Client, error) {
-	// If string does not look like AWS, for now fallback to dummy
-	if !strings.HasPrefix(id, "arn:aws") {
-		return dummy.NewSecretManager(), nil
+func (m *Mux) resolveScheme(id string) (Scheme, error) {
+	for _, s := range m.schemes {
+		if s.Match(id) {
+			return s, nil
+		}
 	}
 
-	// AWS Support
-	resource, err := arn.Parse(id)
-	if err != nil {
-		return nil, err
+	patterns := make([]string, 0, len(m.schemes))
+	for _, s := range m.schemes {
+		patterns = append(patterns, s.Pattern)
 	}
-	switch resource.Service {
-	case "ssm":
-		return m.withCache("ssm", func() (secretmanager.Client, error) {
-			return aws.NewSSM(context.Background())
-		})
-	case "secretsmanager":
-		return m.withCache("secretsmanager", func() (secretmanager.Client, error) {
-			return aws.NewSecretsManager(context.Background())
-		})
+	return Scheme{}, fmt.Errorf("%w %q, supported schemes: %s", ErrUnsupportedScheme, id, strings.Join(patterns, ", "))
+}
+
+func (m *Mux) resolveProvider(id string) (secretmanager.Client, error) {
+	_, client, err := m.Route(id)
+	return client, err
+}
+
+// Route returns the name and client of the provider serving the identifier, creating the client
+// on first use, so that version lookups are grouped by provider.
+func (m *Mux) Route(id string) (string, secretmanager.Client, error) {
+	s, err := m.resolveScheme(id)
+	if err != nil {
+		return "", nil, err
 	}
+	client, err := m.withCache(s.Name, func() (secretmanager.Client, error) {
+		client, err := s.New(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, mw := range m.middleware {
+			client = mw(s.Name, client)
+		}
+		return client, nil
+	})
+	return s.Name, client, err
+}
 
-	return nil, errors.New("unknown provider")
+// ValidateIdentifier reports an error when the identifier does not match any registered scheme.
+func (m *Mux) ValidateIdentifier(id string) error {
+	_, err := m.resolveScheme(id)
+	return err
 }
 
 func (m *Mux) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
@@ -70,8 +208,13 @@ func (m *Mux) GetSecretVersion(ctx context.Context, id string) (string, error) {
 	return provider.GetSecretVersion(ctx, id)
 }
 
+// NewMux creates a new Mux with all built-in schemes registered.
 func NewMux() *Mux {
-	return &Mux{
+	m := &Mux{
 		providers: map[string]secretmanager.Client{},
 	}
+	for _, s := range DefaultSchemes() {
+		m.Register(s)
+	}
+	return m
 }
@@ -0,0 +1,167 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/providers/dummy"
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+)
+
+func TestMuxValidateIdentifier(t *testing.T) {
+	m := NewMux()
+
+	valid := []string{
+		"arn:aws:secretsmanager:us-west-2:123456789012:secret:prod/db-AbCdEf",
+		"arn:aws-us-gov:ssm:us-gov-west-1:123456789012:parameter/app/key",
+		"vault://secret/data/myapp/database",
+		"file:///run/secrets/db",
+		"dummy://anything",
+	}
+	for _, id := range valid {
+		if err := m.ValidateIdentifier(id); err != nil {
+			t.Errorf("Expected %s to be valid, got %v", id, err)
+		}
+	}
+
+	invalid := []string{
+		"arn:aws:s3:::bucket/key",
+		"vualt://secret/data/myapp/database",
+		"prod/db/password",
+	}
+	for _, id := range invalid {
+		err := m.ValidateIdentifier(id)
+		if !errors.Is(err, ErrUnsupportedScheme) {
+			t.Errorf("Expected ErrUnsupportedScheme for %s, got %v", id, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), "vault://") || !strings.Contains(err.Error(), "arn:aws:secretsmanager:*") {
+			t.Errorf("Expected error to list supported schemes, got %v", err)
+		}
+	}
+}
+
+func TestMuxUnknownIdentifierDoesNotFallBack(t *testing.T) {
+	m := NewMux()
+
+	if _, err := m.GetSecretValue(context.Background(), "typo://secret"); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("Expected ErrUnsupportedScheme, got %v", err)
+	}
+	if _, err := m.GetSecretVersion(context.Background(), "typo://secret"); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("Expected ErrUnsupportedScheme, got %v", err)
+	}
+}
+
+func TestMuxFileScheme(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(p, []byte("from-file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMux()
+	value, err := m.GetSecretValue(context.Background(), "file://"+p)
+	if err != nil {
+		t.Fatalf("GetSecretValue failed: %v", err)
+	}
+	if string(value) != "from-file" {
+		t.Errorf("Expected 'from-file', got '%s'", value)
+	}
+
+	v1, err := m.GetSecretVersion(context.Background(), "file://"+p)
+	if err != nil {
+		t.Fatalf("GetSecretVersion failed: %v", err)
+	}
+	if err := os.WriteFile(p, []byte("rotated"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := m.GetSecretVersion(context.Background(), "file://"+p)
+	if err != nil {
+		t.Fatalf("GetSecretVersion failed: %v", err)
+	}
+	if v1 == v2 {
+		t.Errorf("Expected version to change after the file was rewritten, got %s twice", v1)
+	}
+}
+
+// batchClient records batch version requests.
+type batchClient struct {
+	calls [][]string
+}
+
+func (b *batchClient) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	return nil, nil
+}
+
+func (b *batchClient) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	return "single", nil
+}
+
+func (b *batchClient) GetSecretVersions(ctx context.Context, ids []string) (map[string]string, error) {
+	b.calls = append(b.calls, ids)
+	versions := make(map[string]string, len(ids))
+	for _, id := range ids {
+		versions[id] = "batch"
+	}
+	return versions, nil
+}
+
+func TestMuxRoutesVersionsByProvider(t *testing.T) {
+	batch := &batchClient{}
+	m := &Mux{providers: map[string]secretmanager.Client{}}
+	m.Register(Scheme{
+		Name:    "batch",
+		Pattern: "batch://",
+		Match:   PrefixMatcher("batch://"),
+		New: func(ctx context.Context) (secretmanager.Client, error) {
+			return batch, nil
+		},
+	})
+	m.Register(Scheme{
+		Name:    "dummy",
+		Pattern: dummy.Scheme,
+		Match:   PrefixMatcher(dummy.Scheme),
+		New: func(ctx context.Context) (secretmanager.Client, error) {
+			return dummy.NewSecretManager(), nil
+		},
+	})
+
+	versions, err := secretmanager.GetSecretVersions(context.Background(), m, []string{"batch://a", "dummy://x", "batch://b", "typo://c"}, 4, time.Second)
+	if !errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("Expected ErrUnsupportedScheme for typo://c, got %v", err)
+	}
+	if len(batch.calls) != 1 || len(batch.calls[0]) != 2 {
+		t.Fatalf("Expected one batch call with 2 identifiers, got %v", batch.calls)
+	}
+	if versions["batch://a"] != "batch" || versions["batch://b"] != "batch" {
+		t.Errorf("Expected batched versions, got %v", versions)
+	}
+	if _, ok := versions["dummy://x"]; !ok {
+		t.Errorf("Expected a version for dummy://x, got %v", versions)
+	}
+	if _, ok := versions["typo://c"]; ok {
+		t.Errorf("Expected no version for typo://c")
+	}
+}
+
+func TestMuxMiddleware(t *testing.T) {
+	m := NewMux()
+	var wrapped []string
+	m.Use(func(provider string, client secretmanager.Client) secretmanager.Client {
+		wrapped = append(wrapped, provider)
+		return client
+	})
+
+	for range 2 {
+		if _, err := m.GetSecretValue(context.Background(), "dummy://secret"); err != nil {
+			t.Fatalf("GetSecretValue failed: %v", err)
+		}
+	}
+	if len(wrapped) != 1 || wrapped[0] != "dummy" {
+		t.Errorf("Expected the dummy provider to be wrapped once, got %v", wrapped)
+	}
+}
@@ -0,0 +1,264 @@
+// Package vault provides HashiCorp Vault implementations of secret management interfaces.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Scheme is the identifier prefix handled by the Vault provider.
+const Scheme = "vault://"
+
+const defaultAddress = "https://127.0.0.1:8200"
+
+// KV implements the secretmanager.Client interface for the Vault KV version 2 secrets engine.
+// Identifiers take the form vault://<mount>/data/<path>, for example vault://secret/data/myapp/database.
+// A mount with several segments is followed by a colon, as in vault://team/kv:myapp/database.
+type KV struct {
+	address   string
+	namespace string
+	client    *http.Client
+
+	roleID       string
+	secretID     string
+	approleMount string
+
+	mu    sync.Mutex
+	token string
+}
+
+// ResponseError is returned when Vault answers a request with a non-successful status code.
+type ResponseError struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *ResponseError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("vault: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("vault: unexpected status %d: %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+// HTTPStatusCode returns the status code Vault answered with, so that a sealed or standby server
+// (503) or a rate limit quota (429) is retried while a denied policy (403) is not.
+func (e *ResponseError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// GetSecretValue retrieves the data of the current version of a KV v2 secret.
+// The key/value pairs are returned as a JSON object.
+func (k *KV) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	mount, secretPath, err := parseIdentifier(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := k.do(ctx, http.MethodGet, mount+"/data/"+secretPath, nil, &body); err != nil {
+		return nil, err
+	}
+	if len(body.Data.Data) == 0 || string(body.Data.Data) == "null" {
+		return nil, fmt.Errorf("vault: secret %s has no data", id)
+	}
+	return body.Data.Data, nil
+}
+
+// GetSecretVersion retrieves the current version of a KV v2 secret from its metadata.
+func (k *KV) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	mount, secretPath, err := parseIdentifier(id)
+	if err != nil {
+		return "", err
+	}
+
+	var body struct {
+		Data struct {
+			CurrentVersion int `json:"current_version"`
+		} `json:"data"`
+	}
+	if err := k.do(ctx, http.MethodGet, mount+"/metadata/"+secretPath, nil, &body); err != nil {
+		return "", err
+	}
+	if body.Data.CurrentVersion == 0 {
+		return "", fmt.Errorf("vault: no current version found for %s", id)
+	}
+	return strconv.Itoa(body.Data.CurrentVersion), nil
+}
+
+// do performs an authenticated request against the Vault HTTP API and decodes the JSON response into out.
+// When AppRole authentication is configured, a rejected token is renewed once by logging in again.
+func (k *KV) do(ctx context.Context, method, apiPath string, in, out any) error {
+	token, err := k.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = k.request(ctx, method, apiPath, token, in, out)
+
+	var respErr *ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden && k.roleID != "" {
+		if token, err = k.login(ctx); err != nil {
+			return err
+		}
+		return k.request(ctx, method, apiPath, token, in, out)
+	}
+	return err
+}
+
+func (k *KV) request(ctx context.Context, method, apiPath, token string, in, out any) error {
+	var reqBody io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, k.address+"/v1/"+apiPath, reqBody)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if k.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", k.namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respErr := &ResponseError{StatusCode: resp.StatusCode}
+		var body struct {
+			Errors []string `json:"errors"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil {
+			respErr.Errors = body.Errors
+		}
+		return respErr
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (k *KV) currentToken(ctx context.Context) (string, error) {
+	k.mu.Lock()
+	token := k.token
+	k.mu.Unlock()
+	if token != "" || k.roleID == "" {
+		return token, nil
+	}
+	return k.login(ctx)
+}
+
+// login exchanges the configured AppRole credentials for a client token.
+func (k *KV) login(ctx context.Context) (string, error) {
+	var body struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	creds := map[string]string{
+		"role_id":   k.roleID,
+		"secret_id": k.secretID,
+	}
+	if err := k.request(ctx, http.MethodPost, "auth/"+k.approleMount+"/login", "", creds, &body); err != nil {
+		return "", fmt.Errorf("vault: approle login: %w", err)
+	}
+	if body.Auth.ClientToken == "" {
+		return "", errors.New("vault: approle login returned no client token")
+	}
+
+	k.mu.Lock()
+	k.token = body.Auth.ClientToken
+	k.mu.Unlock()
+	return body.Auth.ClientToken, nil
+}
+
+// parseIdentifier splits a vault:// identifier into the KV mount and the secret path.
+// The mount is the first path segment, optionally followed by data: both vault://secret/data/app/db
+// and vault://secret/app/db address the secret app/db on the secret mount, and vault://secret/app/data/db
+// addresses app/data/db. A mount with several segments is separated from the path by a colon,
+// as in vault://team/kv:app/db.
+func parseIdentifier(id string) (mount string, secretPath string, err error) {
+	if !strings.HasPrefix(id, Scheme) {
+		return "", "", fmt.Errorf("vault: identifier %q does not start with %s", id, Scheme)
+	}
+	p := strings.Trim(strings.TrimPrefix(id, Scheme), "/")
+
+	var ok bool
+	if mount, secretPath, ok = strings.Cut(p, ":"); ok {
+		mount = strings.Trim(mount, "/")
+		secretPath = strings.TrimPrefix(strings.Trim(secretPath, "/"), "data/")
+	} else {
+		mount, secretPath, _ = strings.Cut(p, "/")
+		secretPath = strings.TrimPrefix(secretPath, "data/")
+	}
+	if mount == "" || secretPath == "" {
+		return "", "", fmt.Errorf("vault: identifier %q must name a mount and a secret path", id)
+	}
+	return mount, secretPath, nil
+}
+
+// NewKV creates a new Vault KV v2 client configured from the standard Vault environment variables.
+// VAULT_ADDR, VAULT_NAMESPACE and VAULT_CACERT configure the connection. VAULT_TOKEN is used for token
+// authentication, otherwise VAULT_ROLE_ID and VAULT_SECRET_ID are exchanged for a token via AppRole
+// (mounted at VAULT_APPROLE_MOUNT, "approle" by default).
+func NewKV(ctx context.Context) (*KV, error) {
+	k := &KV{
+		address:      strings.TrimRight(os.Getenv("VAULT_ADDR"), "/"),
+		namespace:    os.Getenv("VAULT_NAMESPACE"),
+		client:       &http.Client{},
+		roleID:       os.Getenv("VAULT_ROLE_ID"),
+		secretID:     os.Getenv("VAULT_SECRET_ID"),
+		approleMount: os.Getenv("VAULT_APPROLE_MOUNT"),
+		token:        os.Getenv("VAULT_TOKEN"),
+	}
+	if k.address == "" {
+		k.address = defaultAddress
+	}
+	if k.approleMount == "" {
+		k.approleMount = "approle"
+	}
+	if k.token == "" && k.roleID == "" {
+		return nil, errors.New("vault: either VAULT_TOKEN or VAULT_ROLE_ID must be set")
+	}
+
+	if caFile := os.Getenv("VAULT_CACERT"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("vault: reading VAULT_CACERT: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("vault: no certificates found in %s", caFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		k.client.Transport = transport
+	}
+
+	return k, nil
+}
@@ -0,0 +1,150 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestServer starts an httptest stand-in for Vault serving a single KV v2 secret at secret/myapp/database.
+func newTestServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("GET /v1/secret/data/myapp/database", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"password":"s3cr3t","username":"app"},"metadata":{"version":3}}}`))
+	})
+	mux.HandleFunc("GET /v1/secret/metadata/myapp/database", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"current_version":3,"oldest_version":1}}`))
+	})
+	mux.HandleFunc("POST /v1/auth/approle/login", func(w http.ResponseWriter, r *http.Request) {
+		var creds map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil || creds["role_id"] != "role" || creds["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"` + token + `"}}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestKVTokenAuth(t *testing.T) {
+	srv := newTestServer(t, "root-token")
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "root-token")
+	t.Setenv("VAULT_ROLE_ID", "")
+
+	kv, err := NewKV(context.Background())
+	if err != nil {
+		t.Fatalf("NewKV failed: %v", err)
+	}
+
+	version, err := kv.GetSecretVersion(context.Background(), "vault://secret/data/myapp/database")
+	if err != nil {
+		t.Fatalf("GetSecretVersion failed: %v", err)
+	}
+	if version != "3" {
+		t.Errorf("Expected version 3, got %s", version)
+	}
+
+	value, err := kv.GetSecretValue(context.Background(), "vault://secret/data/myapp/database")
+	if err != nil {
+		t.Fatalf("GetSecretValue failed: %v", err)
+	}
+	if string(value) != `{"password":"s3cr3t","username":"app"}` {
+		t.Errorf("Unexpected secret value: %s", value)
+	}
+}
+
+func TestKVAppRoleAuth(t *testing.T) {
+	srv := newTestServer(t, "approle-token")
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_ROLE_ID", "role")
+	t.Setenv("VAULT_SECRET_ID", "secret")
+
+	kv, err := NewKV(context.Background())
+	if err != nil {
+		t.Fatalf("NewKV failed: %v", err)
+	}
+
+	version, err := kv.GetSecretVersion(context.Background(), "vault://secret/myapp/database")
+	if err != nil {
+		t.Fatalf("GetSecretVersion failed: %v", err)
+	}
+	if version != "3" {
+		t.Errorf("Expected version 3, got %s", version)
+	}
+}
+
+func TestKVPermissionDenied(t *testing.T) {
+	srv := newTestServer(t, "root-token")
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "wrong-token")
+	t.Setenv("VAULT_ROLE_ID", "")
+
+	kv, err := NewKV(context.Background())
+	if err != nil {
+		t.Fatalf("NewKV failed: %v", err)
+	}
+
+	_, err = kv.GetSecretValue(context.Background(), "vault://secret/data/myapp/database")
+	respErr, ok := err.(*ResponseError)
+	if !ok {
+		t.Fatalf("Expected *ResponseError, got %v", err)
+	}
+	if respErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", respErr.StatusCode)
+	}
+}
+
+func TestParseIdentifier(t *testing.T) {
+	tests := []struct {
+		id, mount, path string
+		wantErr         bool
+	}{
+		{id: "vault://secret/data/myapp/database", mount: "secret", path: "myapp/database"},
+		{id: "vault://secret/myapp/database", mount: "secret", path: "myapp/database"},
+		{id: "vault://secret/myapp/data/db", mount: "secret", path: "myapp/data/db"},
+		{id: "vault://secret/data/data/db", mount: "secret", path: "data/db"},
+		{id: "vault://team/kv:app", mount: "team/kv", path: "app"},
+		{id: "vault://team/kv:data/app/data/db", mount: "team/kv", path: "app/data/db"},
+		{id: "vault://team/kv:", wantErr: true},
+		{id: "vault://secret", wantErr: true},
+		{id: "arn:aws:ssm:us-east-1:123456789012:parameter/app", wantErr: true},
+	}
+	for _, tt := range tests {
+		mount, path, err := parseIdentifier(tt.id)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.id, err)
+			continue
+		}
+		if mount != tt.mount || path != tt.path {
+			t.Errorf("%s: expected %s %s, got %s %s", tt.id, tt.mount, tt.path, mount, path)
+		}
+	}
+}
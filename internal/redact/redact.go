@@ -0,0 +1,262 @@
+// Package redact masks known secret values in text before it leaves secretary.
+package redact
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Mask replaces every redacted value in logs.
+const Mask = "[REDACTED]"
+
+// MinLength is the length below which values are not redacted: masking every occurrence of a
+// value of one or two characters would garble unrelated text without protecting anything.
+const MinLength = 4
+
+// Set holds the secret values to redact, along with their base64 and URL-escaped forms.
+// Values are registered under a key, the secret identifier, so that a rotated secret replaces
+// its previous value. The replaced value stays registered until it is released, as the
+// application may keep using it until it was reloaded. It is safe for concurrent use.
+type Set struct {
+	mu       sync.RWMutex
+	entries  map[string][]string
+	replaced map[string][]replaced
+	// generation counts the values replaced so far.
+	generation uint64
+	matchers   map[string]*matcher
+}
+
+// replaced is a value replaced by Put, along with the generation it was replaced in.
+type replaced struct {
+	generation uint64
+	variants   []string
+}
+
+// New creates an empty Set.
+func New() *Set {
+	return &Set{entries: make(map[string][]string), replaced: make(map[string][]replaced)}
+}
+
+// Default is the Set the secret retriever registers every value with, and the log
+// handler and output filter redact with.
+var Default = New()
+
+// Put registers the current value of the secret identified by key. The value previously
+// registered under the same key is kept until Release is called with a generation at least
+// the one returned by Generation after Put.
+// Only the value as a whole is registered, not the fields of a JSON document: those often hold
+// host names, ports or user names that appear in unrelated text. Fields an application reads
+// on their own are registered by the caller under their own key.
+func (s *Set) Put(key string, value []byte) {
+	variants := encodings(string(bytes.TrimSpace(value)))
+	variants = slices.DeleteFunc(variants, func(v string) bool { return len(v) < MinLength })
+	slices.Sort(variants)
+	variants = slices.Compact(variants)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.entries[key]
+	if slices.Equal(previous, variants) {
+		return
+	}
+	if ok {
+		s.generation++
+		s.replaced[key] = append(s.replaced[key], replaced{generation: s.generation, variants: previous})
+	}
+	s.entries[key] = variants
+	s.matchers = nil
+}
+
+// Generation returns the number of values replaced so far, to be passed to Release once the
+// application no longer uses any of them.
+func (s *Set) Generation() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generation
+}
+
+// Release forgets the values replaced up to the given generation.
+func (s *Set) Release(generation uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, values := range s.replaced {
+		kept := slices.DeleteFunc(values, func(r replaced) bool { return r.generation <= generation })
+		if len(kept) == len(values) {
+			continue
+		}
+		if len(kept) == 0 {
+			delete(s.replaced, key)
+		} else {
+			s.replaced[key] = kept
+		}
+		s.matchers = nil
+	}
+}
+
+// Delete forgets the value registered under key, along with the values it replaced.
+func (s *Set) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, current := s.entries[key]
+	_, previous := s.replaced[key]
+	if current || previous {
+		delete(s.entries, key)
+		delete(s.replaced, key)
+		s.matchers = nil
+	}
+}
+
+// encodings returns v along with the forms it commonly takes when an application prints it:
+// base64 with the standard and URL alphabets, padded or not, and URL-escaped.
+func encodings(v string) []string {
+	b := []byte(v)
+	return []string{
+		v,
+		base64.StdEncoding.EncodeToString(b),
+		base64.RawStdEncoding.EncodeToString(b),
+		base64.URLEncoding.EncodeToString(b),
+		base64.RawURLEncoding.EncodeToString(b),
+		url.QueryEscape(v),
+		url.PathEscape(v),
+	}
+}
+
+// Len returns the number of registered values, counting every encoding and the replaced
+// values not released yet.
+func (s *Set) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, values := range s.entries {
+		n += len(values)
+	}
+	for _, values := range s.replaced {
+		for _, r := range values {
+			n += len(r.variants)
+		}
+	}
+	return n
+}
+
+// String returns str with every registered value replaced by Mask.
+func (s *Set) String(str string) string {
+	return s.Replace(str, Mask)
+}
+
+// Replace returns str with every registered value replaced by mask. Longer values are
+// matched first, so a value containing another one is masked as a whole.
+func (s *Set) Replace(str, mask string) string {
+	m := s.matcher(mask)
+	if m == nil {
+		return str
+	}
+	return m.replacer.Replace(str)
+}
+
+// matcher finds the registered values in text and replaces them with a mask.
+type matcher struct {
+	replacer *strings.Replacer
+	// values are sorted longest first, raw holds the same values as bytes.
+	values []string
+	raw    [][]byte
+	// byFirst lists the values starting with each byte.
+	byFirst [256][]string
+	maxLen  int
+}
+
+// matcher returns the matcher replacing the registered values with mask, building it after
+// they changed, or nil when there are none.
+func (s *Set) matcher(mask string) *matcher {
+	s.mu.RLock()
+	m, n := s.matchers[mask], len(s.entries)
+	s.mu.RUnlock()
+	if m != nil || n == 0 {
+		return m
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.matchers[mask]; m != nil {
+		return m
+	}
+	var values []string
+	for _, vs := range s.entries {
+		values = append(values, vs...)
+	}
+	for _, rs := range s.replaced {
+		for _, r := range rs {
+			values = append(values, r.variants...)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	slices.SortFunc(values, func(a, b string) int { return len(b) - len(a) })
+	values = slices.Compact(values)
+
+	m = &matcher{values: values, maxLen: len(values[0])}
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, mask)
+		m.raw = append(m.raw, []byte(v))
+		m.byFirst[v[0]] = append(m.byFirst[v[0]], v)
+	}
+	m.replacer = strings.NewReplacer(pairs...)
+	if s.matchers == nil {
+		s.matchers = make(map[string]*matcher)
+	}
+	s.matchers[mask] = m
+	return m
+}
+
+// safeCut returns the length of the longest prefix of b that can be redacted and written
+// without splitting a value: the rest may be the beginning of a value completed by the text
+// that follows, and is at most maxLen-1 bytes long.
+func (m *matcher) safeCut(b []byte) int {
+	cut := len(b)
+	for p := max(0, len(b)-m.maxLen+1); p < len(b); p++ {
+		if m.startsValue(b[p:]) {
+			cut = p
+			break
+		}
+	}
+	// Holding back a tail may split a complete value ending within it, so move the cut
+	// before any value spanning it.
+	for moved := true; moved && cut > 0; {
+		moved = false
+		for _, v := range m.raw {
+			lo, hi := max(0, cut-len(v)+1), min(len(b), cut+len(v)-1)
+			if lo >= hi {
+				continue
+			}
+			if i := bytes.Index(b[lo:hi], v); i >= 0 {
+				cut, moved = lo+i, true
+			}
+		}
+	}
+	return cut
+}
+
+// startsValue reports whether tail is a proper prefix of a value.
+func (m *matcher) startsValue(tail []byte) bool {
+	for _, v := range m.byFirst[tail[0]] {
+		if len(tail) < len(v) && v[:len(tail)] == string(tail) {
+			return true
+		}
+	}
+	return false
+}
+
+// Put registers the current value of a secret with the Default set.
+func Put(key string, value []byte) {
+	Default.Put(key, value)
+}
+
+// String masks the values of the Default set in str.
+func String(str string) string {
+	return Default.String(str)
+}
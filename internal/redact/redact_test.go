@@ -0,0 +1,94 @@
+package redact
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+)
+
+func TestSetString(t *testing.T) {
+	s := New()
+	s.Put("a", []byte("hunter2-password"))
+	s.Put("b", []byte("abc"))
+
+	got := s.String("login with hunter2-password, not abc")
+	if want := "login with [REDACTED], not abc"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestSetLongestFirst(t *testing.T) {
+	s := New()
+	s.Put("a", []byte("secret"))
+	s.Put("b", []byte("secret-suffix"))
+
+	if got := s.String("secret-suffix secret"); got != "[REDACTED] [REDACTED]" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestSetJSONWholeValue(t *testing.T) {
+	doc := `{"user":"admin","password":"s3cr3t-pw","port":54321,"host":"localhost"}`
+	s := New()
+	s.Put("db", []byte(doc))
+
+	if got := s.String("config " + doc); got != "config [REDACTED]" {
+		t.Errorf("Expected the document to be redacted, got %q", got)
+	}
+	const text = "user admin connected to localhost:54321"
+	if got := s.String(text); got != text {
+		t.Errorf("Expected the fields to be left alone, got %q", got)
+	}
+}
+
+func TestSetEncodings(t *testing.T) {
+	const value = "p@ss/word?&=+"
+	s := New()
+	s.Put("id", []byte(value))
+
+	for _, encoded := range []string{
+		base64.StdEncoding.EncodeToString([]byte(value)),
+		base64.RawURLEncoding.EncodeToString([]byte(value)),
+		url.QueryEscape(value),
+		url.PathEscape(value),
+	} {
+		if got := s.Replace("Authorization: "+encoded, "***"); got != "Authorization: ***" {
+			t.Errorf("Expected %q to be redacted, got %q", encoded, got)
+		}
+	}
+}
+
+func TestSetPutKeepsRotatedValueUntilReleased(t *testing.T) {
+	s := New()
+	s.Put("id", []byte("first-value"))
+	s.Put("id", []byte("second-value"))
+	reloaded := s.Generation()
+	s.Put("id", []byte("third-value"))
+
+	if got := s.String("first-value second-value third-value"); got != "[REDACTED] [REDACTED] [REDACTED]" {
+		t.Errorf("Expected the replaced values to stay redacted, got %q", got)
+	}
+	s.Release(reloaded)
+	if got := s.String("first-value second-value third-value"); got != "first-value [REDACTED] [REDACTED]" {
+		t.Errorf("Expected only the released value to be forgotten, got %q", got)
+	}
+	s.Release(s.Generation())
+	if got := s.String("first-value second-value third-value"); got != "first-value second-value [REDACTED]" {
+		t.Errorf("String() = %q", got)
+	}
+	s.Put("id", []byte("fourth-value"))
+	s.Delete("id")
+	if s.Len() != 0 {
+		t.Errorf("Expected no values after Delete, got %d", s.Len())
+	}
+}
+
+func TestSetEmpty(t *testing.T) {
+	s := New()
+	if got := s.String("nothing to hide"); got != "nothing to hide" {
+		t.Errorf("String() = %q", got)
+	}
+	if s.Len() != 0 {
+		t.Errorf("Expected no values, got %d", s.Len())
+	}
+}
@@ -0,0 +1,66 @@
+package redact
+
+import (
+	"io"
+	"sync"
+)
+
+// Writer redacts a stream of text, such as the output of a process, before writing it to
+// another writer. Text is written as soon as it cannot be the beginning of a registered value,
+// so at most the length of the longest value is held back, however long the lines are.
+// It picks up values registered with its Set while streaming.
+type Writer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	set  *Set
+	mask string
+	// pending is the tail of the stream that may be the beginning of a value.
+	pending []byte
+}
+
+// NewWriter returns a Writer replacing the values of set with mask in the text written to w.
+func NewWriter(w io.Writer, set *Set, mask string) *Writer {
+	return &Writer{w: w, set: set, mask: mask}
+}
+
+// Write redacts p and writes it to the underlying writer, holding back a tail that may be the
+// beginning of a value until the next Write or Flush.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, p...)
+	m := w.set.matcher(w.mask)
+	cut := len(w.pending)
+	if m != nil {
+		cut = m.safeCut(w.pending)
+	}
+	if cut == 0 {
+		return len(p), nil
+	}
+	if err := w.write(m, w.pending[:cut]); err != nil {
+		return 0, err
+	}
+	w.pending = append(w.pending[:0], w.pending[cut:]...)
+	return len(p), nil
+}
+
+// Flush redacts and writes the held back tail.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) == 0 {
+		return nil
+	}
+	err := w.write(w.set.matcher(w.mask), w.pending)
+	w.pending = w.pending[:0]
+	return err
+}
+
+func (w *Writer) write(m *matcher, b []byte) error {
+	if m == nil {
+		_, err := w.w.Write(b)
+		return err
+	}
+	_, err := io.WriteString(w.w, m.replacer.Replace(string(b)))
+	return err
+}
@@ -0,0 +1,74 @@
+package redact
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriterSplitWrites(t *testing.T) {
+	const value = "correct-horse-battery-staple"
+	s := New()
+	s.Put("id", []byte(value))
+	s.Put("other", []byte("horse-battery"))
+	input := "token=" + value + "\nline two " + value + value + " end\n"
+
+	// Every way of splitting the stream in two writes yields the same output.
+	for i := range len(input) {
+		var out bytes.Buffer
+		w := NewWriter(&out, s, "***")
+		w.Write([]byte(input[:i]))
+		w.Write([]byte(input[i:]))
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if want := "token=***\nline two ****** end\n"; out.String() != want {
+			t.Fatalf("Split at %d: got %q, want %q", i, out.String(), want)
+		}
+	}
+}
+
+func TestWriterStreamsWithoutValues(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, New(), "***")
+	w.Write([]byte("no secrets"))
+	if out.String() != "no secrets" {
+		t.Errorf("Expected the text to be written as is, got %q", out.String())
+	}
+}
+
+func TestWriterBoundsPendingText(t *testing.T) {
+	s := New()
+	s.Put("id", []byte("abcdef"))
+	var out bytes.Buffer
+	w := NewWriter(&out, s, "***")
+
+	// A long line without a newline is written as it streams, except for a possible
+	// beginning of a value.
+	for range 1000 {
+		w.Write([]byte(strings.Repeat("x", 100) + "abc"))
+		if len(w.pending) >= len("abcdef") {
+			t.Fatalf("Expected less than %d pending bytes, got %d", len("abcdef"), len(w.pending))
+		}
+	}
+	w.Write([]byte("def"))
+	w.Flush()
+	if want := strings.Repeat(strings.Repeat("x", 100)+"abc", 999) + strings.Repeat("x", 100) + "***"; out.String() != want {
+		t.Errorf("Unexpected output suffix %q", out.String()[out.Len()-20:])
+	}
+}
+
+func TestWriterPicksUpRotatedValues(t *testing.T) {
+	s := New()
+	s.Put("id", []byte("old-value"))
+	var out bytes.Buffer
+	w := NewWriter(&out, s, "***")
+
+	w.Write([]byte("old-value\n"))
+	s.Put("id", []byte("new-value"))
+	w.Write([]byte("new-value\n"))
+	w.Flush()
+	if want := "***\n***\n"; out.String() != want {
+		t.Errorf("Got %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,54 @@
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fr0stylo/secretary/internal/audit"
+)
+
+func TestRetrieverAudit(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := audit.New(&buf, []byte("audit-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := NewMockClient()
+	mock.SetSecretValue("prod/db", []byte("audited-value"))
+	mock.SetSecretVersion("prod/db", "v1")
+	dir := t.TempDir()
+	r := NewRetriever(mock, WithPath(dir), WithAudit(log))
+
+	if err := r.CreateSecret(context.Background(), &Secret{Identifier: "prod/db", EnvName: "AUDITED", Path: filepath.Join(dir, "AUDITED")}); err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+	mock.SetSecretVersion("prod/db", "v2")
+	NewWatcher(r).check(context.Background())
+	r.Clean()
+
+	if strings.Contains(buf.String(), "audited-value") {
+		t.Fatalf("Secret value reached the audit log:\n%s", buf.String())
+	}
+	var events []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e audit.Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Invalid entry %q: %v", line, err)
+		}
+		events = append(events, e.Event+":"+e.Version+e.PreviousVersion)
+		if e.Event == audit.EventFetch && e.Fingerprint != log.Fingerprint([]byte("audited-value")) {
+			t.Errorf("Unexpected fingerprint %q", e.Fingerprint)
+		}
+	}
+	want := []string{"fetch:v1", "write:v1", "version_change:v2v1", "fetch:v2", "write:v2", "cleanup:"}
+	if strings.Join(events, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+	if _, err := audit.Verify(&buf, []byte("audit-key")); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
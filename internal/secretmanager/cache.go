@@ -0,0 +1,105 @@
+// Package secretmanager provides interfaces and implementations for secret management.
+package secretmanager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrCacheMiss is returned by Cache.Load when no usable entry exists for a secret.
+var ErrCacheMiss = errors.New("secret not cached")
+
+// CacheEntry is the last value retrieved for a secret.
+type CacheEntry struct {
+	Version   string    `json:"version"`
+	Value     []byte    `json:"value"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Cache keeps the last retrieved value of every secret on disk, encrypted with AES-256-GCM,
+// so that secretary can start from it when the provider is unavailable.
+// Entries older than the maximum staleness are never served.
+type Cache struct {
+	dir          string
+	aead         cipher.AEAD
+	maxStaleness time.Duration
+}
+
+// NewCache creates a cache in dir, encrypting entries with a key derived from key.
+// A maxStaleness of zero allows entries of any age to be served.
+func NewCache(dir string, key []byte, maxStaleness time.Duration) (*Cache, error) {
+	if len(key) == 0 {
+		return nil, errors.New("cache key is empty")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir, aead: aead, maxStaleness: maxStaleness}, nil
+}
+
+// path returns the file holding the entry of the secret, named after a hash of its identifier.
+func (c *Cache) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".enc")
+}
+
+// Store saves the version and value of a secret, replacing any previous entry.
+func (c *Cache) Store(id, version string, value []byte) error {
+	plain, err := json.Marshal(CacheEntry{Version: version, Value: value, FetchedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	// The identifier is authenticated with the entry so that an entry cannot be swapped for another secret's.
+	sealed := c.aead.Seal(nonce, nonce, plain, []byte(id))
+	return writeFile(c.path(id), sealed, fileAttrs{mode: 0o600, uid: -1, gid: -1})
+}
+
+// Load returns the cached entry of a secret. It returns an error wrapping ErrCacheMiss when the
+// secret is not cached or its entry is older than the maximum staleness.
+func (c *Cache) Load(id string) (*CacheEntry, error) {
+	sealed, err := os.ReadFile(c.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("cache entry is truncated")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting cache entry: %w", err)
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(plain, &entry); err != nil {
+		return nil, err
+	}
+	if age := time.Since(entry.FetchedAt); c.maxStaleness > 0 && age > c.maxStaleness {
+		return nil, fmt.Errorf("%w: entry is %s old, more than the maximum staleness of %s", ErrCacheMiss, age.Round(time.Second), c.maxStaleness)
+	}
+	return &entry, nil
+}
@@ -0,0 +1,125 @@
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheStoreLoad(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewCache(dir, []byte("cache-key"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewCache failed: %v", err)
+	}
+	if err := cache.Store("id", "v1", []byte("super-secret")); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	entry, err := cache.Load("id")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if entry.Version != "v1" || string(entry.Value) != "super-secret" {
+		t.Errorf("Expected v1/super-secret, got %s/%s", entry.Version, entry.Value)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 cache file, got %d", len(files))
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if bytes.Contains(raw, []byte("super-secret")) {
+		t.Error("Expected the cache file to be encrypted")
+	}
+	if info, _ := os.Stat(filepath.Join(dir, files[0].Name())); info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected mode 0600, got %o", info.Mode().Perm())
+	}
+
+	if _, err := cache.Load("other"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss for an unknown secret, got %v", err)
+	}
+	other, _ := NewCache(dir, []byte("wrong-key"), time.Hour)
+	if _, err := other.Load("id"); err == nil {
+		t.Error("Expected an error when decrypting with the wrong key")
+	}
+}
+
+func TestCacheMaxStaleness(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), []byte("cache-key"), time.Nanosecond)
+	if err != nil {
+		t.Fatalf("NewCache failed: %v", err)
+	}
+	if err := cache.Store("id", "v1", []byte("value")); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := cache.Load("id"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss for a stale entry, got %v", err)
+	}
+}
+
+func TestCreateSecretServesStaleValue(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), []byte("cache-key"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewCache failed: %v", err)
+	}
+	dir := t.TempDir()
+
+	// A first run populates the cache.
+	mock := NewMockClient()
+	mock.SetSecretValue("id", []byte("cached-value"))
+	mock.SetSecretVersion("id", "v1")
+	first := NewRetriever(mock, WithPath(dir), WithCache(cache))
+	if err := first.CreateSecret(context.Background(), &Secret{Identifier: "id", EnvName: "STALE_SECRET", Path: filepath.Join(dir, "STALE_SECRET")}); err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+	first.Clean()
+
+	// A restart while the provider is down starts from the cache.
+	down := &flakyClient{MockClient: mock, failures: 100, err: statusError(http.StatusServiceUnavailable)}
+	r := NewRetriever(down, WithPath(dir), WithCache(cache), WithRetryPolicy(fastRetry(2)))
+	defer r.Clean()
+	secret := &Secret{Identifier: "id", EnvName: "STALE_SECRET", Path: filepath.Join(dir, "STALE_SECRET")}
+	if err := r.CreateSecret(context.Background(), secret); err != nil {
+		t.Fatalf("Expected CreateSecret to fall back to the cache, got %v", err)
+	}
+	if !secret.Stale || !r.Degraded() {
+		t.Error("Expected the secret to be marked stale and the retriever degraded")
+	}
+	if secret.Version != "v1" {
+		t.Errorf("Expected cached version v1, got %s", secret.Version)
+	}
+	content, _ := os.ReadFile(secret.Path)
+	if string(content) != "cached-value" {
+		t.Errorf("Expected cached value, got '%s'", content)
+	}
+
+	// Once the provider is back with the same version, the secret is no longer degraded.
+	down.failures = 0
+	NewWatcher(r).check(context.Background())
+	if secret.Stale || r.Degraded() {
+		t.Error("Expected the secret to recover once the provider is available")
+	}
+}
+
+func TestCreateSecretDoesNotServeStaleValueOnPermanentError(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), []byte("cache-key"), time.Hour)
+	if err != nil {
+		t.Fatalf("NewCache failed: %v", err)
+	}
+	if err := cache.Store("id", "v1", []byte("cached-value")); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	client := &flakyClient{MockClient: NewMockClient(), failures: 100, err: statusError(http.StatusForbidden)}
+	r := NewRetriever(client, WithPath(t.TempDir()), WithCache(cache), WithRetryPolicy(fastRetry(2)))
+	if err := r.CreateSecret(context.Background(), &Secret{Identifier: "id", EnvName: "STALE_SECRET"}); err == nil {
+		t.Error("Expected a permanent error not to fall back to the cache")
+	}
+}
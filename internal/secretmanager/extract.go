@@ -0,0 +1,145 @@
+// Package secretmanager provides interfaces and implementations for secret management.
+package secretmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseIdentifier splits a declared secret identifier into the provider identifier and an optional
+// JSON key selecting a single field of a structured secret. The key follows a '#', for example
+// arn:aws:secretsmanager:us-west-2:123456789012:secret:prod/db#password.
+func ParseIdentifier(declared string) (identifier string, key string) {
+	identifier, key, _ = strings.Cut(declared, "#")
+	return identifier, key
+}
+
+// Exploded reports whether the secret is written as a directory with one file per JSON key.
+// This is requested with a key ending in '*', such as #* for the top level object or #db.* for a nested one.
+func (s *Secret) Exploded() bool {
+	return s.Key == "*" || strings.HasSuffix(s.Key, ".*")
+}
+
+// ExtractFiles decodes a JSON secret value and returns the contents of one file per key of the
+// object addressed by an exploded Key. Values are encoded the same way as by Extract.
+func (s *Secret) ExtractFiles(value []byte) (map[string][]byte, error) {
+	if !s.Exploded() {
+		return nil, fmt.Errorf("secret %s: key %q does not select a set of keys", s.Identifier, s.Key)
+	}
+
+	doc, err := decodeJSON(value)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s is not valid JSON, cannot explode it into files: %w", s.Identifier, err)
+	}
+	if parent := strings.TrimSuffix(strings.TrimSuffix(s.Key, "*"), "."); parent != "" {
+		if doc, err = lookupKey(doc, parent); err != nil {
+			return nil, fmt.Errorf("secret %s: %w", s.Identifier, err)
+		}
+	}
+	object, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("secret %s: key %q does not address a JSON object", s.Identifier, s.Key)
+	}
+
+	files := make(map[string][]byte, len(object))
+	for name, field := range object {
+		// Names starting with .. are reserved for the ..data symlink and the generation directories
+		// written with symlink swapping.
+		if name == "" || name == "." || strings.HasPrefix(name, "..") || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("secret %s: key %q cannot be used as a file name", s.Identifier, name)
+		}
+		if files[name], err = encodeField(field); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Extract returns the part of a retrieved secret value that should be exposed for this secret.
+// Without a Key the value is returned unchanged. Otherwise the value is decoded as JSON and the
+// field addressed by Key is returned: strings are returned as is, any other JSON value is
+// returned in its JSON encoding.
+func (s *Secret) Extract(value []byte) ([]byte, error) {
+	if s.Key == "" {
+		return value, nil
+	}
+
+	doc, err := decodeJSON(value)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s is not valid JSON, cannot select key %q: %w", s.Identifier, s.Key, err)
+	}
+	field, err := lookupKey(doc, s.Key)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %w", s.Identifier, err)
+	}
+	return encodeField(field)
+}
+
+func decodeJSON(value []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func encodeField(field any) ([]byte, error) {
+	if str, ok := field.(string); ok {
+		return []byte(str), nil
+	}
+	return json.Marshal(field)
+}
+
+// lookupKey walks a decoded JSON document along a key path. The path is a dot separated list of
+// object keys and array indexes, optionally written in JSONPath form: password, db.hosts[0] and
+// $.db.hosts.0 are all accepted.
+func lookupKey(doc any, key string) (any, error) {
+	segments, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	current := doc
+	for i, segment := range segments {
+		switch node := current.(type) {
+		case map[string]any:
+			next, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found", strings.Join(segments[:i+1], "."))
+			}
+			current = next
+		case []any:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("index %q out of range at %q", segment, strings.Join(segments[:i], "."))
+			}
+			current = node[idx]
+		default:
+			return nil, fmt.Errorf("key %q does not address an object or array", strings.Join(segments[:i], "."))
+		}
+	}
+	return current, nil
+}
+
+func splitKey(key string) ([]string, error) {
+	key = strings.TrimPrefix(key, "$")
+	key = strings.TrimPrefix(key, ".")
+	key = strings.ReplaceAll(key, "[", ".")
+	key = strings.ReplaceAll(key, "]", "")
+	if key == "" {
+		return nil, fmt.Errorf("empty key")
+	}
+
+	segments := strings.Split(key, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return segments, nil
+}
@@ -0,0 +1,175 @@
+package secretmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fr0stylo/secretary/internal/redact"
+)
+
+func TestParseIdentifier(t *testing.T) {
+	id, key := ParseIdentifier("arn:aws:secretsmanager:us-west-2:123456789012:secret:prod/db#password")
+	if id != "arn:aws:secretsmanager:us-west-2:123456789012:secret:prod/db" {
+		t.Errorf("Unexpected identifier %s", id)
+	}
+	if key != "password" {
+		t.Errorf("Expected key password, got %s", key)
+	}
+
+	id, key = ParseIdentifier("vault://secret/data/app")
+	if id != "vault://secret/data/app" || key != "" {
+		t.Errorf("Expected identifier without key, got %s and %q", id, key)
+	}
+}
+
+func TestSecretExtract(t *testing.T) {
+	value := []byte(`{"username":"app","password":"s3cr3t","port":5432,"db":{"hosts":["a","b"]}}`)
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "", want: string(value)},
+		{key: "password", want: "s3cr3t"},
+		{key: "port", want: "5432"},
+		{key: "db", want: `{"hosts":["a","b"]}`},
+		{key: "db.hosts[1]", want: "b"},
+		{key: "$.db.hosts.0", want: "a"},
+	}
+	for _, tt := range tests {
+		s := &Secret{Identifier: "test", Key: tt.key}
+		got, err := s.Extract(value)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.key, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.key, tt.want, got)
+		}
+	}
+
+	for _, key := range []string{"missing", "password.length", "db.hosts[2]", "db..hosts"} {
+		s := &Secret{Identifier: "test", Key: key}
+		if _, err := s.Extract(value); err == nil {
+			t.Errorf("%q: expected an error", key)
+		}
+	}
+
+	s := &Secret{Identifier: "test", Key: "password"}
+	if _, err := s.Extract([]byte("not json")); err == nil {
+		t.Error("Expected an error for a non JSON secret")
+	}
+}
+
+func TestCreateSecretsFromEnvironmentWithKeys(t *testing.T) {
+	client := NewMockClient()
+	client.SetSecretValue("prod/db", []byte(`{"username":"app","password":"s3cr3t"}`))
+	client.SetSecretVersion("prod/db", "v1")
+
+	dir := t.TempDir()
+	retriever := NewRetriever(client, WithPath(dir))
+	defer retriever.Clean()
+
+	testEnv := []string{
+		"SECRETARY_DB_USER=prod/db#username",
+		"SECRETARY_DB_PASSWORD=prod/db#password",
+	}
+	if err := retriever.CreateSecretsFromEnvironment(context.Background(), testEnv); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+
+	if len(retriever.pulledVersions) != 2 {
+		t.Fatalf("Expected 2 secrets in pulledVersions, got %d", len(retriever.pulledVersions))
+	}
+	for _, s := range retriever.pulledVersions {
+		if s.Identifier != "prod/db" {
+			t.Errorf("Expected versions to be tracked on the parent secret, got %s", s.Identifier)
+		}
+	}
+
+	for name, want := range map[string]string{"DB_USER": "app", "DB_PASSWORD": "s3cr3t"} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(content) != want {
+			t.Errorf("Expected %s to contain %s, got %s", name, want, content)
+		}
+	}
+	if got := redact.String("password s3cr3t"); got != "password "+redact.Mask {
+		t.Errorf("Expected the selected password to be redacted, got %q", got)
+	}
+}
+
+func TestSecretExtractFiles(t *testing.T) {
+	value := []byte(`{"username":"app","password":"s3cr3t","db":{"host":"localhost","port":5432}}`)
+
+	s := &Secret{Identifier: "test", Key: "db.*"}
+	files, err := s.ExtractFiles(value)
+	if err != nil {
+		t.Fatalf("ExtractFiles failed: %v", err)
+	}
+	if len(files) != 2 || string(files["host"]) != "localhost" || string(files["port"]) != "5432" {
+		t.Errorf("Unexpected files %v", files)
+	}
+
+	s = &Secret{Identifier: "test", Key: "username.*"}
+	if _, err := s.ExtractFiles(value); err == nil {
+		t.Error("Expected an error when exploding a non object value")
+	}
+
+	s = &Secret{Identifier: "test", Key: "*"}
+	for _, doc := range []string{`{"../escape":"x"}`, `{"..data":"x"}`, `{"..2025_01_01":"x"}`} {
+		if _, err := s.ExtractFiles([]byte(doc)); err == nil {
+			t.Errorf("Expected an error for a key that is not a valid file name in %s", doc)
+		}
+	}
+}
+
+func TestCreateSecretExploded(t *testing.T) {
+	client := NewMockClient()
+	client.SetSecretValue("prod/db", []byte(`{"username":"app","password":"s3cr3t"}`))
+	client.SetSecretVersion("prod/db", "v1")
+
+	dir := t.TempDir()
+	retriever := NewRetriever(client, WithPath(dir))
+
+	if err := retriever.CreateSecretsFromEnvironment(context.Background(), []string{"SECRETARY_DB=prod/db#*"}); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+
+	secretDir := filepath.Join(dir, "DB")
+	if os.Getenv("DB") != secretDir {
+		t.Errorf("Expected DB to point at %s, got %s", secretDir, os.Getenv("DB"))
+	}
+	for name, want := range map[string]string{"username": "app", "password": "s3cr3t"} {
+		content, err := os.ReadFile(filepath.Join(secretDir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(content) != want {
+			t.Errorf("Expected %s to contain %s, got %s", name, want, content)
+		}
+	}
+
+	// Simulate a rotation that drops a key and adds a new one.
+	client.SetSecretValue("prod/db", []byte(`{"username":"app","token":"t0k3n"}`))
+	client.SetSecretVersion("prod/db", "v2")
+	if err := retriever.CreateSecret(context.Background(), retriever.pulledVersions[0]); err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(secretDir, "password")); !os.IsNotExist(err) {
+		t.Errorf("Expected password file to be removed after rotation, got %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(secretDir, "token")); err != nil || string(content) != "t0k3n" {
+		t.Errorf("Expected token file to be created after rotation, got %s (%v)", content, err)
+	}
+
+	if err := retriever.Clean(); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if _, err := os.Stat(secretDir); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got %v", secretDir, err)
+	}
+}
@@ -0,0 +1,86 @@
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/redact"
+)
+
+// captureLogs installs a JSON logger at debug level, redacting with the default set, for the
+// duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", slog.LevelDebug, redact.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestSecretValuesNeverReachLogs(t *testing.T) {
+	buf := captureLogs(t)
+	const password, token = "p4ssw0rd-never-logged", "plain-token-never-logged"
+
+	mock := NewMockClient()
+	mock.SetSecretValue("prod/db", []byte(`{"user":"app","password":"`+password+`"}`))
+	mock.SetSecretVersion("prod/db", "v1")
+	mock.SetSecretValue("prod/token", []byte(token))
+	mock.SetSecretVersion("prod/token", "v1")
+
+	dir := t.TempDir()
+	r := NewRetriever(mock, WithPath(dir), WithRetryPolicy(fastRetry(2)))
+	defer r.Clean()
+	t.Setenv("SECRETARY_DB_PASSWORD", "prod/db#password")
+	t.Setenv("SECRETARY_TOKEN", "prod/token")
+	if err := r.CreateSecretsFromEnvironment(context.Background(), []string{
+		"SECRETARY_DB_PASSWORD=prod/db#password",
+		"SECRETARY_TOKEN=prod/token",
+		"SECRETARY_DEBUG=true",
+	}); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+
+	// A rotation fails with errors echoing the values, as a misbehaving provider might.
+	mock.SetSecretVersion("prod/db", "v2")
+	mock.SetSecretVersion("prod/token", "v2")
+	leaky := &flakyClient{MockClient: mock, failures: 100, err: errors.New("upstream rejected " + password + " and " + token)}
+	r.client = leaky
+	NewWatcher(r).check(context.Background())
+	leaky.failures = 0
+	secret := &Secret{Identifier: "prod/db", Key: "password", EnvName: "OTHER", Path: filepath.Join(dir, "OTHER")}
+	if err := r.CreateSecret(context.Background(), secret); err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+
+	logs := buf.String()
+	if !strings.Contains(logs, redact.Mask) || !strings.Contains(logs, `"identifier":"prod/db"`) {
+		t.Fatalf("Expected the failures to be logged with their identifier, got:\n%s", logs)
+	}
+	for _, value := range []string{password, token} {
+		if strings.Contains(logs, value) {
+			t.Errorf("Secret value %q reached the logs:\n%s", value, logs)
+		}
+	}
+}
+
+func TestReservedNamesAreNotSecrets(t *testing.T) {
+	r := NewRetriever(NewMockClient(), WithPath(t.TempDir()))
+	defer r.Clean()
+	if err := r.CreateSecretsFromEnvironment(context.Background(), []string{"SECRETARY_DEBUG=true"}); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+	if len(r.Secrets()) != 0 {
+		t.Errorf("Expected SECRETARY_DEBUG not to declare a secret, got %v", r.Secrets())
+	}
+}
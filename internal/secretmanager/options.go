@@ -0,0 +1,149 @@
+// Package secretmanager provides interfaces and implementations for secret management.
+package secretmanager
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFileMode is the permission of secret files unless configured otherwise.
+const DefaultFileMode os.FileMode = 0o600
+
+// SplitOptions separates per-secret options, written as a URL query after a '?', from a
+// provider identifier. For example prod/db?mode=0440&uid=1000 yields prod/db and mode=0440&uid=1000.
+func SplitOptions(identifier string) (string, string) {
+	identifier, options, _ := strings.Cut(identifier, "?")
+	return identifier, options
+}
+
+// SetOptions applies per-secret options given as a URL query. Supported options are
+// mode (octal file permissions), uid and gid (numeric owner of the written files),
+// on-change (the reload policy applied when the secret changes), inject (file, the
+// default, or env to pass the value itself in the environment), format (raw, the default,
+// or base64 to decode the value before exposing it) and refresh (how often the secret is
+// checked for changes, when less often than the Watcher's frequency).
+func (s *Secret) SetOptions(query string) error {
+	if query == "" {
+		return nil
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return fmt.Errorf("invalid secret options %q: %w", query, err)
+	}
+
+	for name, v := range values {
+		value := v[len(v)-1]
+		switch name {
+		case "mode":
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || mode > 0o777 {
+				return fmt.Errorf("invalid mode %q, expected octal permissions such as 0440", value)
+			}
+			s.Mode = os.FileMode(mode)
+		case "uid":
+			uid, err := strconv.Atoi(value)
+			if err != nil || uid < 0 {
+				return fmt.Errorf("invalid uid %q", value)
+			}
+			s.UID = &uid
+		case "gid":
+			gid, err := strconv.Atoi(value)
+			if err != nil || gid < 0 {
+				return fmt.Errorf("invalid gid %q", value)
+			}
+			s.GID = &gid
+		case "on-change":
+			if value == "" {
+				return fmt.Errorf("empty on-change policy")
+			}
+			s.OnChange = value
+		case "inject":
+			switch value {
+			case "file":
+				s.InjectEnv = false
+			case "env":
+				s.InjectEnv = true
+			default:
+				return fmt.Errorf("invalid inject %q, expected file or env", value)
+			}
+		case "format":
+			switch value {
+			case FormatRaw, FormatBase64:
+				s.Format = value
+			default:
+				return fmt.Errorf("invalid format %q, expected raw or base64", value)
+			}
+		case "refresh":
+			refresh, err := time.ParseDuration(value)
+			if err != nil || refresh < 0 {
+				return fmt.Errorf("invalid refresh %q, expected a duration such as 5m", value)
+			}
+			s.Refresh = refresh
+		default:
+			return fmt.Errorf("unknown secret option %q", name)
+		}
+	}
+	return nil
+}
+
+// Formats of secret values.
+const (
+	// FormatRaw exposes the value as retrieved.
+	FormatRaw = "raw"
+	// FormatBase64 decodes a base64 encoded value, such as a binary keystore, before exposing it.
+	FormatBase64 = "base64"
+)
+
+// decode returns the value the secret exposes given its format.
+func (s *Secret) decode(value []byte) ([]byte, error) {
+	if s.Format != FormatBase64 {
+		return value, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(value)))
+	if err != nil {
+		return nil, fmt.Errorf("secret %s is not valid base64: %w", s.EnvName, err)
+	}
+	return decoded, nil
+}
+
+// fileAttrs describes the permissions and ownership applied to written files.
+// A uid or gid of -1 leaves the respective owner unchanged.
+type fileAttrs struct {
+	mode os.FileMode
+	uid  int
+	gid  int
+}
+
+// attrs returns the file attributes of the secret, falling back to defaultMode.
+func (s *Secret) attrs(defaultMode os.FileMode) fileAttrs {
+	a := fileAttrs{mode: defaultMode, uid: -1, gid: -1}
+	if s.Mode != 0 {
+		a.mode = s.Mode
+	}
+	if s.UID != nil {
+		a.uid = *s.UID
+	}
+	if s.GID != nil {
+		a.gid = *s.GID
+	}
+	return a
+}
+
+// dirMode returns the directory permission matching the file mode, adding the search bit
+// wherever the file mode grants read access.
+func (a fileAttrs) dirMode() os.FileMode {
+	return a.mode | (a.mode&0o444)>>2
+}
+
+// chown applies the configured ownership to the file at p.
+func (a fileAttrs) chown(p string) error {
+	if a.uid == -1 && a.gid == -1 {
+		return nil
+	}
+	return os.Lchown(p, a.uid, a.gid)
+}
@@ -0,0 +1,160 @@
+package secretmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSecretSetOptions(t *testing.T) {
+	s := &Secret{}
+	if err := s.SetOptions("mode=0440&uid=1000&gid=2000"); err != nil {
+		t.Fatalf("SetOptions failed: %v", err)
+	}
+	if s.Mode != 0o440 {
+		t.Errorf("Expected mode 0440, got %o", s.Mode)
+	}
+	if s.UID == nil || *s.UID != 1000 || s.GID == nil || *s.GID != 2000 {
+		t.Errorf("Expected uid 1000 and gid 2000, got %v %v", s.UID, s.GID)
+	}
+
+	if err := s.SetOptions("format=base64&refresh=5m"); err != nil {
+		t.Fatalf("SetOptions failed: %v", err)
+	}
+	if s.Format != FormatBase64 || s.Refresh != 5*time.Minute {
+		t.Errorf("Expected base64 format refreshed every 5m, got %q %v", s.Format, s.Refresh)
+	}
+
+	for _, query := range []string{"mode=0999", "mode=rw", "uid=-1", "gid=app", "owner=root", "format=hex", "refresh=-1s", "refresh=daily"} {
+		if err := (&Secret{}).SetOptions(query); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestCreateSecretFileMode(t *testing.T) {
+	client := NewMockClient()
+	client.SetSecretValue("prod/db", []byte(`{"username":"app","password":"s3cr3t"}`))
+
+	dir := t.TempDir()
+	retriever := NewRetriever(client, WithPath(dir))
+	testEnv := []string{
+		"SECRETARY_DEFAULT=prod/db",
+		"SECRETARY_SHARED=prod/db?mode=0440#password",
+		"SECRETARY_EXPLODED=prod/db?mode=0640#*",
+	}
+	if err := retriever.CreateSecretsFromEnvironment(context.Background(), testEnv); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+	defer retriever.Clean()
+
+	tests := map[string]os.FileMode{
+		"DEFAULT":           0o600,
+		"SHARED":            0o440,
+		"EXPLODED":          os.ModeDir | 0o750,
+		"EXPLODED/password": 0o640,
+		"EXPLODED/username": 0o640,
+	}
+	for name, want := range tests {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", name, err)
+		}
+		if info.Mode() != want {
+			t.Errorf("Expected %s to have mode %v, got %v", name, want, info.Mode())
+		}
+	}
+}
+
+func TestCreateSecretOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing file ownership requires root")
+	}
+
+	client := NewMockClient()
+	client.SetSecretValue("prod/db", []byte("s3cr3t"))
+
+	dir := t.TempDir()
+	retriever := NewRetriever(client, WithPath(dir))
+	if err := retriever.CreateSecretsFromEnvironment(context.Background(), []string{"SECRETARY_OWNED=prod/db?uid=1234&gid=5678"}); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+	defer retriever.Clean()
+
+	info, err := os.Stat(filepath.Join(dir, "OWNED"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := info.Sys().(*syscall.Stat_t)
+	if stat.Uid != 1234 || stat.Gid != 5678 {
+		t.Errorf("Expected owner 1234:5678, got %d:%d", stat.Uid, stat.Gid)
+	}
+}
+
+func TestCreateSecretsFromEnvironmentInvalidOptions(t *testing.T) {
+	retriever := NewRetriever(NewMockClient(), WithPath(t.TempDir()))
+	err := retriever.CreateSecretsFromEnvironment(context.Background(), []string{"SECRETARY_BAD=prod/db?mode=rw"})
+	if err == nil || !strings.Contains(err.Error(), "SECRETARY_BAD") {
+		t.Errorf("Expected an error naming SECRETARY_BAD, got %v", err)
+	}
+}
+
+func TestCreateSecretInjectEnv(t *testing.T) {
+	client := NewMockClient()
+	client.SetSecretValue("prod/db", []byte(`{"username":"app","password":"s3cr3t"}`))
+
+	dir := t.TempDir()
+	retriever := NewRetriever(client, WithPath(dir))
+	if err := retriever.CreateSecretsFromEnvironment(context.Background(), []string{"SECRETARY_INJECTED_PASSWORD=prod/db?inject=env#password"}); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+
+	if got := os.Getenv("INJECTED_PASSWORD"); got != "s3cr3t" {
+		t.Errorf("Expected the value in the environment, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "INJECTED_PASSWORD")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written, got %v", err)
+	}
+
+	if err := retriever.Clean(); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if _, ok := os.LookupEnv("INJECTED_PASSWORD"); ok {
+		t.Error("Expected the environment variable to be unset by Clean")
+	}
+
+	exploded := &Secret{Identifier: "prod/db", Key: "*", EnvName: "EXPLODED", InjectEnv: true}
+	if err := retriever.CreateSecret(context.Background(), exploded); err == nil {
+		t.Error("Expected an error when injecting an exploded secret")
+	}
+}
+
+func TestCreateSecretBase64(t *testing.T) {
+	client := NewMockClient()
+	client.SetSecretValue("prod/keystore", []byte("a2V5c3RvcmUtYnl0ZXM=\n"))
+	client.SetSecretValue("prod/plain", []byte("not base64!"))
+
+	dir := t.TempDir()
+	retriever := NewRetriever(client, WithPath(dir))
+	defer retriever.Clean()
+	if err := retriever.CreateSecretsFromEnvironment(context.Background(), []string{"SECRETARY_KEYSTORE=prod/keystore?format=base64"}); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "KEYSTORE"))
+	if err != nil {
+		t.Fatalf("Failed to read secret: %v", err)
+	}
+	if string(content) != "keystore-bytes" {
+		t.Errorf("Expected the decoded value, got %q", content)
+	}
+
+	for _, env := range []string{"SECRETARY_PLAIN=prod/plain?format=base64", "SECRETARY_EXPLODED=prod/keystore?format=base64#*"} {
+		if err := retriever.CreateSecretsFromEnvironment(context.Background(), []string{env}); err == nil {
+			t.Errorf("%s: expected an error", env)
+		}
+	}
+}
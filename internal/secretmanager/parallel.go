@@ -0,0 +1,29 @@
+// Package secretmanager provides interfaces and implementations for secret management.
+package secretmanager
+
+import "sync"
+
+// DefaultConcurrency is the number of secrets retrieved in parallel unless configured otherwise.
+const DefaultConcurrency = 8
+
+// forEach calls fn for every index in [0, n), running at most limit calls at a time.
+// It waits for all calls to finish and returns their errors in index order.
+func forEach(limit, n int, fn func(i int) error) []error {
+	if limit < 1 {
+		limit = 1
+	}
+	errs := make([]error, n)
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := range n {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,85 @@
+package secretmanager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowClient is a MockClient that takes a while to answer and fails for identifiers starting with "fail/".
+type slowClient struct {
+	*MockClient
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+}
+
+func (s *slowClient) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	s.mu.Lock()
+	s.active++
+	s.maxSeen = max(s.maxSeen, s.active)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if strings.HasPrefix(id, "fail/") {
+		return "", errors.New("provider unavailable")
+	}
+	return s.MockClient.GetSecretVersion(ctx, id)
+}
+
+func TestCreateSecretsFromEnvironmentParallel(t *testing.T) {
+	client := &slowClient{MockClient: NewMockClient()}
+	retriever := NewRetriever(client, WithPath(t.TempDir()), WithConcurrency(3))
+	defer retriever.Clean()
+
+	var env []string
+	for _, name := range []string{"A", "B", "C", "D", "E", "F", "G", "H", "I"} {
+		env = append(env, "SECRETARY_PAR_"+name+"=ok/"+name)
+	}
+	start := time.Now()
+	if err := retriever.CreateSecretsFromEnvironment(context.Background(), env); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+
+	if len(retriever.Secrets()) != 9 {
+		t.Errorf("Expected 9 secrets, got %d", len(retriever.Secrets()))
+	}
+	if client.maxSeen != 3 {
+		t.Errorf("Expected at most 3 parallel retrievals, saw %d", client.maxSeen)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected parallel retrieval to take about 60ms, took %s", elapsed)
+	}
+}
+
+func TestCreateSecretsFromEnvironmentReportsEveryFailure(t *testing.T) {
+	client := &slowClient{MockClient: NewMockClient()}
+	retriever := NewRetriever(client, WithPath(t.TempDir()), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	defer retriever.Clean()
+
+	env := []string{
+		"SECRETARY_PAR_OK=ok/one",
+		"SECRETARY_PAR_BAD1=fail/one",
+		"SECRETARY_PAR_BAD2=fail/two",
+	}
+	err := retriever.CreateSecretsFromEnvironment(context.Background(), env)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, name := range []string{"SECRETARY_PAR_BAD1", "SECRETARY_PAR_BAD2"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected error to name %s, got %v", name, err)
+		}
+	}
+	if strings.Contains(err.Error(), "SECRETARY_PAR_OK") {
+		t.Errorf("Expected error not to name the successful secret, got %v", err)
+	}
+}
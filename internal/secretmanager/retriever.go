@@ -3,18 +3,40 @@ package secretmanager
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path"
 	"slices"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/audit"
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/metrics"
+	"github.com/fr0stylo/secretary/internal/redact"
+	"github.com/fr0stylo/secretary/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer creates the spans of secret retrieval and rotation.
+var tracer = tracing.Tracer("github.com/fr0stylo/secretary/internal/secretmanager")
+
+// ReservedNames lists the SECRETARY_ variables that configure secretary itself rather than
+// declare a secret.
+var ReservedNames = []string{"SECRETARY_DEBUG"}
+
 // Retriever manages the retrieval and monitoring of secrets.
 type Retriever struct {
-	client         Client
-	config         *Config
+	client Client
+	config *Config
+	// mu guards pulledVersions and templates, which are updated by parallel retrievals.
+	mu             sync.Mutex
 	pulledVersions []*Secret
+	templates      []*Template
 	runCancel      context.CancelFunc
 }
 
@@ -31,85 +53,417 @@ func NewRetriever(client Client, opts ...ConfigOption) *Retriever {
 	}
 }
 
-// CreateSecretsFromEnvironment creates secrets from environment variables with the SECRETARY_ prefix.
-func (r *Retriever) CreateSecretsFromEnvironment(ctx context.Context, envSecrets []string) error {
+// CreateSecretsFromEnvironment creates secrets from environment variables with the SECRETARY_ prefix,
+// except the ReservedNames. See SecretsFromEnvironment and CreateSecrets.
+func (r *Retriever) CreateSecretsFromEnvironment(ctx context.Context, envSecrets []string) (err error) {
+	ctx, span := tracer.Start(ctx, "CreateSecretsFromEnvironment")
+	defer func() { tracing.End(span, err) }()
+
+	secrets, err := r.SecretsFromEnvironment(envSecrets)
+	if err != nil {
+		return err
+	}
+	return r.createSecrets(ctx, span, secrets)
+}
+
+// SecretsFromEnvironment parses the secrets declared by environment variables with the SECRETARY_
+// prefix, except the ReservedNames, and validates their options.
+func (r *Retriever) SecretsFromEnvironment(envSecrets []string) ([]*Secret, error) {
+	var secrets []*Secret
+	var errs []error
 	for _, envSecret := range envSecrets {
 		if !strings.HasPrefix(envSecret, "SECRETARY_") {
 			continue
 		}
 		str := strings.SplitN(envSecret, "=", 2)
 		if len(str) != 2 {
-			log.Printf("invalid secret name: %s", envSecret)
+			slog.Warn("Invalid secret name", logging.EnvName, envSecret)
+			continue
+		}
+		if slices.Contains(ReservedNames, str[0]) {
 			continue
 		}
 		secretName := strings.TrimPrefix(str[0], "SECRETARY_")
+		if secretName == "" {
+			slog.Warn("Invalid secret name", logging.EnvName, str[0])
+			continue
+		}
 		secretPath := path.Join(r.config.Path, secretName)
-		secretIdentifier := str[1]
+		secretIdentifier, secretKey := ParseIdentifier(str[1])
+		secretIdentifier, secretOptions := SplitOptions(secretIdentifier)
 
 		s := &Secret{
 			Identifier: secretIdentifier,
+			Key:        secretKey,
 			EnvName:    secretName,
 			Version:    "",
 			Path:       secretPath,
+			Source:     str[0],
+			envVar:     str[0],
 		}
+		if err := s.SetOptions(secretOptions); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", str[0], err))
+			continue
+		}
+		secrets = append(secrets, s)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// MergeSecrets combines the secrets declared in a configuration file with those declared in the
+// environment. A secret declared in the environment replaces the one of the file with the same
+// EnvName, so that a deployment can override a single secret without editing the file.
+func MergeSecrets(file, env []*Secret) []*Secret {
+	merged := slices.Clone(file)
+	for _, s := range env {
+		i := slices.IndexFunc(merged, func(f *Secret) bool { return f.EnvName == s.EnvName })
+		if i < 0 {
+			merged = append(merged, s)
+			continue
+		}
+		slog.Info("Secret declared in the environment overrides the configuration file",
+			logging.EnvName, s.EnvName, "overridden", merged[i].Source, "source", s.Source)
+		merged[i] = s
+	}
+	return merged
+}
+
+// CreateSecrets creates the given secrets. Secrets written to the same path are rejected, and when
+// the client implements Validator, identifiers are validated, before any secret is retrieved. Secrets are retrieved in parallel, up to the configured
+// concurrency, and every failure is reported along with the Source of the secret. The SECRETARY_
+// variables declaring created secrets are unset, so the application does not inherit them.
+func (r *Retriever) CreateSecrets(ctx context.Context, secrets []*Secret) (err error) {
+	ctx, span := tracer.Start(ctx, "CreateSecrets")
+	defer func() { tracing.End(span, err) }()
+	return r.createSecrets(ctx, span, secrets)
+}
+
+// createSecrets creates the given secrets as described by CreateSecrets, under the span of the caller.
+func (r *Retriever) createSecrets(ctx context.Context, span trace.Span, secrets []*Secret) error {
+	var errs []error
+	written := make(map[string]*Secret)
+	for _, s := range secrets {
+		if s.InjectEnv {
+			continue
+		}
+		p := path.Clean(s.Path)
+		if first, ok := written[p]; ok {
+			errs = append(errs, fmt.Errorf("%s: secret %s is written to %s, like the secret declared at %s", s.source(), s.EnvName, p, first.source()))
+			continue
+		}
+		written[p] = s
+	}
+	if v, ok := r.client.(Validator); ok {
+		for _, s := range secrets {
+			if err := v.ValidateIdentifier(s.Identifier); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.source(), err))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	span.SetAttributes(attribute.Int("secretary.secrets", len(secrets)))
+	err := errors.Join(forEach(r.config.Concurrency, len(secrets), func(i int) error {
+		s := secrets[i]
 		if err := r.CreateSecret(ctx, s); err != nil {
-			return err
+			return fmt.Errorf("%s: %w", s.source(), err)
 		}
-		if err := os.Unsetenv(str[0]); err != nil {
-			return err
+		if s.envVar == "" {
+			return nil
 		}
+		return os.Unsetenv(s.envVar)
+	})...)
+	if err == nil {
+		metrics.LastRefresh.SetToCurrentTime()
 	}
-	return nil
+	return err
 }
 
-// Clean removes all secret files and unsets related environment variables.
+// source returns where the secret was declared, or its EnvName when unknown.
+func (s *Secret) source() string {
+	if s.Source != "" {
+		return s.Source
+	}
+	return s.EnvName
+}
+
+// Secrets returns the secrets retrieved so far.
+func (r *Retriever) Secrets() []*Secret {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.pulledVersions)
+}
+
+// Templates returns the templates rendered so far.
+func (r *Retriever) Templates() []*Template {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.templates)
+}
+
+// Clean removes all secret files and rendered templates and unsets related environment variables.
 // This should be called when the application is shutting down to ensure secrets are not left on disk.
 func (r *Retriever) Clean() error {
-	for _, secret := range r.pulledVersions {
-		if err := os.Remove(secret.Path); err != nil {
-			log.Printf("error removing secret file %s: %v", secret.Path, err)
+	for _, secret := range r.Secrets() {
+		if !secret.InjectEnv {
+			remove := os.Remove
+			if secret.Exploded() {
+				remove = os.RemoveAll
+			}
+			err := remove(secret.Path)
+			if err != nil {
+				slog.Error("Error removing secret file", logging.EnvName, secret.EnvName, logging.Path, secret.Path, logging.Err(err))
+			}
+			r.config.Audit.Record(audit.Entry{Event: audit.EventCleanup, Identifier: secret.Identifier, EnvName: secret.EnvName, Path: secret.Path, Error: errString(err)})
 		}
 		if err := os.Unsetenv(secret.EnvName); err != nil {
-			log.Printf("error unsetting environment variable %s: %v", secret.EnvName, err)
+			slog.Error("Error unsetting environment variable", logging.EnvName, secret.EnvName, logging.Err(err))
+		}
+	}
+	for _, t := range r.Templates() {
+		err := os.Remove(t.Destination)
+		if err != nil {
+			slog.Error("Error removing rendered template", logging.Template, t.Source, logging.Path, t.Destination, logging.Err(err))
 		}
+		r.config.Audit.Record(audit.Entry{Event: audit.EventCleanup, Template: t.Source, Path: t.Destination, Error: errString(err)})
 	}
 	return nil
 }
 
 // CreateSecret creates a secret file and sets an environment variable pointing to it.
-func (r *Retriever) CreateSecret(ctx context.Context, secret *Secret) error {
-	tctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
-	defer cancel()
-	version, err := r.client.GetSecretVersion(tctx, secret.Identifier)
+// Secrets with InjectEnv set are not written to disk, the environment variable holds the value instead.
+func (r *Retriever) CreateSecret(ctx context.Context, secret *Secret) (err error) {
+	ctx, span := tracer.Start(ctx, "CreateSecret", trace.WithAttributes(
+		tracing.Identifier.String(secret.Identifier),
+		tracing.EnvName.String(secret.EnvName),
+	))
+	defer func() {
+		if err != nil {
+			r.mu.Lock()
+			secret.lastError = err
+			r.mu.Unlock()
+		}
+		tracing.End(span, err)
+	}()
+	if secret.InjectEnv && secret.Exploded() {
+		return fmt.Errorf("secret %s: an exploded key cannot be injected into the environment", secret.EnvName)
+	}
+	if secret.Format == FormatBase64 && secret.Exploded() {
+		return fmt.Errorf("secret %s: an exploded key cannot be decoded from base64", secret.EnvName)
+	}
+	entry, stale, err := r.fetch(ctx, secret.Identifier)
 	if err != nil {
 		return err
 	}
-	secret.Version = version
+	span.SetAttributes(tracing.Version.String(entry.Version), attribute.Bool("secretary.secret.stale", stale))
+	r.mu.Lock()
+	secret.Version = entry.Version
+	secret.Stale = stale
+	secret.lastChecked = entry.FetchedAt
+	secret.lastError = nil
 	if !slices.ContainsFunc(r.pulledVersions, func(s *Secret) bool {
-		return s.Identifier == secret.Identifier
+		return s.EnvName == secret.EnvName
 	}) {
 		r.pulledVersions = append(r.pulledVersions, secret)
 	}
-	log.Printf(
-		"Creating secret %s (version %s) at %s",
-		secret.Identifier,
-		secret.Version,
-		secret.Path,
-	)
+	r.mu.Unlock()
+	if secret.InjectEnv {
+		slog.Info("Creating secret in the environment", logging.Identifier, secret.Identifier, logging.EnvName, secret.EnvName, logging.Version, secret.Version)
+	} else {
+		slog.Info("Creating secret", logging.Identifier, secret.Identifier, logging.EnvName, secret.EnvName, logging.Version, secret.Version, logging.Path, secret.Path)
+	}
 
-	retrievedSecret, err := r.client.GetSecretValue(tctx, secret.Identifier)
-	if err != nil {
-		return err
+	retrievedSecret := entry.Value
+	written := audit.Entry{Event: audit.EventWrite, Identifier: secret.Identifier, EnvName: secret.EnvName, Version: entry.Version, Path: secret.Path}
+	if secret.Exploded() {
+		files, err := secret.ExtractFiles(retrievedSecret)
+		if err != nil {
+			return err
+		}
+		if err := writeDir(secret, files, secret.attrs(r.config.FileMode), r.config.SymlinkSwap); err != nil {
+			return err
+		}
+		written.Fingerprint = r.config.Audit.Fingerprint(retrievedSecret)
+		r.config.Audit.Record(written)
+		return os.Setenv(secret.EnvName, secret.Path)
 	}
-	f, err := os.Create(secret.Path)
+
+	retrievedSecret, err = secret.Extract(retrievedSecret)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	_, err = f.Write(retrievedSecret)
-	if err != nil {
+	if secret.Format == FormatBase64 {
+		if retrievedSecret, err = secret.decode(retrievedSecret); err != nil {
+			return err
+		}
+	}
+	if secret.Key != "" || secret.Format == FormatBase64 {
+		// The application reads the selected or decoded value on its own, so it is redacted
+		// as well as the whole secret.
+		redact.Put(secret.EnvName, retrievedSecret)
+	}
+	written.Fingerprint = r.config.Audit.Fingerprint(retrievedSecret)
+	if secret.InjectEnv {
+		written.Path = ""
+		r.config.Audit.Record(written)
+		return os.Setenv(secret.EnvName, string(retrievedSecret))
+	}
+	if err := writeFile(secret.Path, retrievedSecret, secret.attrs(r.config.FileMode)); err != nil {
 		return err
 	}
+	r.config.Audit.Record(written)
 
 	return os.Setenv(secret.EnvName, secret.Path)
 }
+
+// fetch retrieves the current version and value of a secret and stores them in the cache.
+// When the provider is unavailable, the cached entry is returned instead, if there is one
+// within the maximum staleness, and stale is set. Every value is registered for redaction
+// before it is returned, and every fetch is audited.
+func (r *Retriever) fetch(ctx context.Context, id string) (entry *CacheEntry, stale bool, err error) {
+	defer func() {
+		fetched := audit.Entry{Event: audit.EventFetch, Identifier: id, Stale: stale}
+		if entry != nil {
+			fetched.Version = entry.Version
+			fetched.Fingerprint = r.config.Audit.Fingerprint(entry.Value)
+		}
+		fetched.Error = errString(err)
+		r.config.Audit.Record(fetched)
+	}()
+	version, err := r.getVersion(ctx, id)
+	var value []byte
+	if err == nil {
+		value, err = r.getValue(ctx, id)
+	}
+	cache := r.config.Cache
+	if err == nil {
+		redact.Put(id, value)
+		if cache != nil {
+			if err := cache.Store(id, version, value); err != nil {
+				slog.Error("Error caching secret", logging.Identifier, id, logging.Err(err))
+			}
+		}
+		return &CacheEntry{Version: version, Value: value, FetchedAt: time.Now()}, false, nil
+	}
+	if cache == nil || !r.config.Retry.retryable(err) {
+		return nil, false, err
+	}
+
+	entry, cacheErr := cache.Load(id)
+	if cacheErr != nil {
+		return nil, false, fmt.Errorf("%w (no cached value: %w)", err, cacheErr)
+	}
+	redact.Put(id, entry.Value)
+	slog.Warn("Provider unavailable, serving the cached secret (degraded)",
+		logging.Identifier, id,
+		logging.Version, entry.Version,
+		"fetched_at", entry.FetchedAt.Format(time.RFC3339),
+		logging.Err(err),
+	)
+	return entry, true, nil
+}
+
+// Degraded reports whether any secret is currently served from the cache.
+func (r *Retriever) Degraded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.ContainsFunc(r.pulledVersions, func(s *Secret) bool {
+		return s.Stale
+	})
+}
+
+// Status returns the state of every secret retrieved so far, without their values.
+func (r *Retriever) Status() []SecretStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := make([]SecretStatus, 0, len(r.pulledVersions))
+	for _, s := range r.pulledVersions {
+		st := SecretStatus{
+			EnvName:     s.EnvName,
+			Identifier:  s.Identifier,
+			Key:         s.Key,
+			Version:     s.Version,
+			LastChecked: s.lastChecked,
+			Stale:       s.Stale,
+			Refresh:     s.Refresh,
+		}
+		if s.lastError != nil {
+			st.LastError = s.lastError.Error()
+		}
+		status = append(status, st)
+	}
+	return status
+}
+
+// checked records the outcome of checking the version of a secret with the provider.
+// A successful check of a stale secret means its cached value is the current one.
+func (r *Retriever) checked(secret *Secret, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		secret.lastError = err
+		return
+	}
+	if secret.Stale {
+		slog.Info("Provider available again, the cached secret is current", logging.Identifier, secret.Identifier, logging.Version, secret.Version)
+	}
+	secret.Stale = false
+	secret.lastChecked = time.Now()
+	secret.lastError = nil
+}
+
+// due reports whether a secret should be checked for changes at now, given its refresh interval.
+func (r *Retriever) due(secret *Secret, now time.Time) bool {
+	if secret.Refresh == 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return now.Sub(secret.lastChecked) >= secret.Refresh
+}
+
+// call runs fn under the retry policy, giving every attempt its own timeout.
+func (r *Retriever) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.config.Retry.Do(ctx, func(ctx context.Context) error {
+		tctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+		return fn(tctx)
+	})
+}
+
+// getVersion retrieves the current version of a secret, retrying transient failures.
+func (r *Retriever) getVersion(ctx context.Context, id string) (version string, err error) {
+	ctx, span := tracer.Start(ctx, "GetSecretVersion", trace.WithAttributes(tracing.Identifier.String(id)))
+	defer func() { tracing.End(span, err) }()
+	err = r.call(ctx, func(ctx context.Context) error {
+		var err error
+		version, err = r.client.GetSecretVersion(ctx, id)
+		return err
+	})
+	return version, err
+}
+
+// getValue retrieves the value of a secret, retrying transient failures.
+func (r *Retriever) getValue(ctx context.Context, id string) (value []byte, err error) {
+	ctx, span := tracer.Start(ctx, "GetSecretValue", trace.WithAttributes(tracing.Identifier.String(id)))
+	defer func() { tracing.End(span, err) }()
+	err = r.call(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = r.client.GetSecretValue(ctx, id)
+		return err
+	})
+	return value, err
+}
+
+// errString returns the message of err, or an empty string when it is nil.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
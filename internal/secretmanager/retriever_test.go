@@ -2,13 +2,19 @@ package secretmanager
 
 import (
 	"context"
+	"errors"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 // MockClient is a mock implementation of Client for testing
 type MockClient struct {
+	mu             sync.Mutex
 	secretValues   map[string][]byte
 	secretVersions map[string]string
 }
@@ -23,16 +29,22 @@ func NewMockClient() *MockClient {
 
 // SetSecretValue sets a secret value for testing
 func (m *MockClient) SetSecretValue(id string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.secretValues[id] = value
 }
 
 // SetSecretVersion sets a secret version for testing
 func (m *MockClient) SetSecretVersion(id string, version string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.secretVersions[id] = version
 }
 
 // GetSecretValue implements Client.GetSecretValue
 func (m *MockClient) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if value, ok := m.secretValues[id]; ok {
 		return value, nil
 	}
@@ -41,6 +53,8 @@ func (m *MockClient) GetSecretValue(ctx context.Context, id string) ([]byte, err
 
 // GetSecretVersion implements Client.GetSecretVersion
 func (m *MockClient) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if version, ok := m.secretVersions[id]; ok {
 		return version, nil
 	}
@@ -203,3 +217,91 @@ func TestCreateSecretsFromEnvironment(t *testing.T) {
 	}
 	defer os.Remove("/tmp/SECRET1")
 }
+
+// validatingClient is a MockClient that only accepts identifiers with the mock:// prefix.
+type validatingClient struct {
+	*MockClient
+}
+
+func (v validatingClient) ValidateIdentifier(id string) error {
+	if !strings.HasPrefix(id, "mock://") {
+		return errors.New("unsupported secret identifier, supported schemes: mock://")
+	}
+	return nil
+}
+
+func TestCreateSecretsFromEnvironmentRejectsUnknownIdentifier(t *testing.T) {
+	client := validatingClient{NewMockClient()}
+	retriever := NewRetriever(client, WithPath(t.TempDir()))
+
+	testEnv := []string{
+		"SECRETARY_GOOD=mock://good",
+		"SECRETARY_TYPO=mokc://typo",
+	}
+	err := retriever.CreateSecretsFromEnvironment(context.Background(), testEnv)
+	if err == nil {
+		t.Fatal("Expected an error for the unknown identifier")
+	}
+	if !strings.Contains(err.Error(), "SECRETARY_TYPO") || !strings.Contains(err.Error(), "mock://") {
+		t.Errorf("Expected error to name the env var and list schemes, got %v", err)
+	}
+	if len(retriever.pulledVersions) != 0 {
+		t.Errorf("Expected no secrets to be retrieved, got %d", len(retriever.pulledVersions))
+	}
+}
+
+func TestMergeSecrets(t *testing.T) {
+	file := []*Secret{
+		{Identifier: "prod/db", EnvName: "DB", Source: "secretary.yaml:3"},
+		{Identifier: "prod/api", EnvName: "API", Source: "secretary.yaml:6"},
+	}
+	env := []*Secret{
+		{Identifier: "staging/db", EnvName: "DB", Source: "SECRETARY_DB"},
+		{Identifier: "prod/cache", EnvName: "CACHE", Source: "SECRETARY_CACHE"},
+	}
+	merged := MergeSecrets(file, env)
+	var got []string
+	for _, s := range merged {
+		got = append(got, s.EnvName+"="+s.Identifier)
+	}
+	if want := []string{"DB=staging/db", "API=prod/api", "CACHE=prod/cache"}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if file[0].Identifier != "prod/db" {
+		t.Error("Expected the file secrets not to be modified")
+	}
+}
+
+func TestCreateSecretsRejectsSharedPaths(t *testing.T) {
+	dir := t.TempDir()
+	retriever := NewRetriever(NewMockClient(), WithPath(dir))
+	env, err := retriever.SecretsFromEnvironment([]string{"SECRETARY_SHARED=prod/env"})
+	if err != nil {
+		t.Fatalf("SecretsFromEnvironment failed: %v", err)
+	}
+	file := []*Secret{
+		{Identifier: "prod/a", EnvName: "A", Path: "/tmp/shared", Source: "secretary.yaml:2"},
+		{Identifier: "prod/b", EnvName: "B", Path: "/tmp//shared", Source: "secretary.yaml:4"},
+		{Identifier: "prod/c", EnvName: "C", Path: filepath.Join(dir, "SHARED"), Source: "secretary.yaml:6"},
+		{Identifier: "prod/d", EnvName: "D", Path: "/tmp/shared", InjectEnv: true, Source: "secretary.yaml:8"},
+	}
+
+	err = retriever.CreateSecrets(context.Background(), MergeSecrets(file, env))
+	if err == nil {
+		t.Fatal("Expected an error for the secrets sharing a path")
+	}
+	for _, want := range []string{
+		"secretary.yaml:4: secret B is written to /tmp/shared, like the secret declared at secretary.yaml:2",
+		"SECRETARY_SHARED: secret SHARED is written to " + filepath.Join(dir, "SHARED") + ", like the secret declared at secretary.yaml:6",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to contain %q, got %q", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "secret D") {
+		t.Errorf("Expected a secret injected into the environment not to collide, got %q", err)
+	}
+	if len(retriever.pulledVersions) != 0 {
+		t.Errorf("Expected no secrets to be retrieved, got %d", len(retriever.pulledVersions))
+	}
+}
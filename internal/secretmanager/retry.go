@@ -0,0 +1,135 @@
+// Package secretmanager provides interfaces and implementations for secret management.
+package secretmanager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryPolicy controls how failed provider calls are retried.
+// The delay before retry n is InitialBackoff*Multiplier^(n-1), capped at MaxBackoff
+// and reduced by up to Jitter (a fraction between 0 and 1) at random so that a fleet
+// of instances does not retry in lockstep.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	// Retryable reports whether an error is worth retrying. IsRetryable is used when nil.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with default values.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+}
+
+// Do calls fn until it succeeds, returns an error that is not retryable, the attempts are
+// exhausted or ctx is done. It returns the last error of fn.
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay := p.Backoff(attempt)
+		slog.Warn("Provider call failed, retrying", "attempt", attempt, "max_attempts", p.MaxAttempts, "delay", delay, logging.Err(err))
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("secretary.attempt", attempt),
+			attribute.String("secretary.retry.delay", delay.String()),
+			attribute.String("exception.message", err.Error()),
+		))
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// retryable classifies err with the policy's Retryable function, or IsRetryable when it has none.
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// Backoff returns the delay before the retry that follows the given attempt.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for range attempt - 1 {
+		d *= p.Multiplier
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	return jitter(time.Duration(d), p.Jitter)
+}
+
+// jitter reduces d by a random amount of up to fraction of d.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+	fraction = min(fraction, 1)
+	return d - time.Duration(rand.Float64()*fraction*float64(d))
+}
+
+// IsRetryable reports whether err is likely transient: a network failure or timeout, an HTTP
+// response with a server error status, 408 (request timeout) or 429 (too many requests), or a
+// throttling error reported by AWS despite its 400 status. Any other error, such as a malformed
+// identifier, a missing secret or a value that cannot be decoded, is permanent, so that it is
+// reported at once rather than after every retry.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) {
+		code := coded.ErrorCode()
+		if strings.Contains(code, "Throttl") || code == "TooManyRequestsException" || code == "RequestLimitExceeded" {
+			return true
+		}
+	}
+
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) {
+		code := status.HTTPStatusCode()
+		return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package secretmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// statusError is an error carrying an HTTP status code, like the provider ResponseErrors.
+type statusError int
+
+func (e statusError) Error() string       { return fmt.Sprintf("status %d", int(e)) }
+func (e statusError) HTTPStatusCode() int { return int(e) }
+
+// codedError is an error carrying an API error code, like the AWS SDK errors.
+type codedError string
+
+func (e codedError) Error() string     { return string(e) }
+func (e codedError) ErrorCode() string { return string(e) }
+
+// flakyClient is a MockClient that fails the first failures calls with err.
+type flakyClient struct {
+	*MockClient
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyClient) fail() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.failures > 0 {
+		f.failures--
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyClient) GetSecretValue(ctx context.Context, id string) ([]byte, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return f.MockClient.GetSecretValue(ctx, id)
+}
+
+func (f *flakyClient) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	if err := f.fail(); err != nil {
+		return "", err
+	}
+	return f.MockClient.GetSecretVersion(ctx, id)
+}
+
+func fastRetry(attempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, true},
+		{fmt.Errorf("get: %w", &url.Error{Op: "Get", URL: "https://vault:8200", Err: io.EOF}), true},
+		{io.ErrUnexpectedEOF, true},
+		{context.DeadlineExceeded, true},
+		{statusError(http.StatusInternalServerError), true},
+		{errors.New(`vault: identifier "vault://onlymount" must have the form vault://<mount>/data/<path>`), false},
+		{errors.New("no current version found"), false},
+		{fmt.Errorf("decoding response: %w", &json.SyntaxError{Offset: 1}), false},
+		{context.Canceled, false},
+		{statusError(http.StatusServiceUnavailable), true},
+		{statusError(http.StatusTooManyRequests), true},
+		{statusError(http.StatusRequestTimeout), true},
+		{statusError(http.StatusNotFound), false},
+		{fmt.Errorf("wrapped: %w", statusError(http.StatusForbidden)), false},
+		{codedError("ThrottlingException"), true},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := p.Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+
+	p.Jitter = 0.5
+	for range 100 {
+		if got := p.Backoff(3); got < 200*time.Millisecond || got > 400*time.Millisecond {
+			t.Fatalf("Backoff(3) with jitter = %s, want between 200ms and 400ms", got)
+		}
+	}
+}
+
+func TestCreateSecretRetriesTransientErrors(t *testing.T) {
+	client := &flakyClient{MockClient: NewMockClient(), failures: 3, err: statusError(http.StatusServiceUnavailable)}
+	client.SetSecretValue("id", []byte("value"))
+	dir := t.TempDir()
+	r := NewRetriever(client, WithPath(dir), WithRetryPolicy(fastRetry(5)))
+	defer r.Clean()
+
+	secret := &Secret{Identifier: "id", EnvName: "RETRY_SECRET", Path: filepath.Join(dir, "RETRY_SECRET")}
+	if err := r.CreateSecret(context.Background(), secret); err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+	if client.calls != 5 {
+		t.Errorf("Expected 5 calls (3 failures, version, value), got %d", client.calls)
+	}
+	content, err := os.ReadFile(secret.Path)
+	if err != nil || string(content) != "value" {
+		t.Errorf("Expected file content 'value', got '%s' (%v)", content, err)
+	}
+}
+
+func TestCreateSecretGivesUpAfterMaxAttempts(t *testing.T) {
+	client := &flakyClient{MockClient: NewMockClient(), failures: 10, err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	r := NewRetriever(client, WithPath(t.TempDir()), WithRetryPolicy(fastRetry(3)))
+
+	err := r.CreateSecret(context.Background(), &Secret{Identifier: "id", EnvName: "RETRY_SECRET"})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if client.calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", client.calls)
+	}
+}
+
+func TestCreateSecretDoesNotRetryPermanentErrors(t *testing.T) {
+	client := &flakyClient{MockClient: NewMockClient(), failures: 10, err: statusError(http.StatusForbidden)}
+	r := NewRetriever(client, WithPath(t.TempDir()), WithRetryPolicy(fastRetry(5)))
+
+	err := r.CreateSecret(context.Background(), &Secret{Identifier: "id", EnvName: "RETRY_SECRET"})
+	var status statusError
+	if !errors.As(err, &status) || status != http.StatusForbidden {
+		t.Errorf("Expected the 403 error, got %v", err)
+	}
+	if client.calls != 1 {
+		t.Errorf("Expected a single attempt, got %d", client.calls)
+	}
+}
+
+func TestRetryPolicyStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 2}
+
+	calls := 0
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err := p.Do(ctx, func(ctx context.Context) error {
+		calls++
+		return errors.New("unavailable")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected one failed call before cancellation, got %d calls and %v", calls, err)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		if d := jitter(time.Second, 0.1); d < 900*time.Millisecond || d > time.Second {
+			t.Fatalf("jitter(1s, 0.1) = %s, want between 900ms and 1s", d)
+		}
+	}
+	if d := jitter(time.Second, 0); d != time.Second {
+		t.Errorf("jitter(1s, 0) = %s, want 1s", d)
+	}
+}
@@ -3,7 +3,15 @@ package secretmanager
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
 	"time"
+
+	"github.com/fr0stylo/secretary/internal/audit"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client defines the interface for retrieving secrets from a secret management service.
@@ -15,11 +23,108 @@ type Client interface {
 	GetSecretVersion(ctx context.Context, id string) (string, error)
 }
 
+// BatchVersioner is implemented by clients that can look up the current versions of several
+// secrets in a single call, reducing the number of requests made by the Watcher.
+type BatchVersioner interface {
+	// GetSecretVersions retrieves the current versions of the given secrets, keyed by identifier.
+	// Secrets whose version could not be retrieved are missing from the result and reported in the error.
+	// An error wrapping errors.ErrUnsupported asks for the versions to be looked up one by one instead.
+	GetSecretVersions(ctx context.Context, ids []string) (map[string]string, error)
+}
+
+// Router is implemented by clients that route each identifier to the client of a provider,
+// such as the mux, so that versions are looked up with the batch support of every provider.
+type Router interface {
+	// Route returns the name of the provider serving the identifier, along with its client.
+	Route(id string) (provider string, client Client, err error)
+}
+
+// GetSecretVersions retrieves the current versions of several secrets. Identifiers of a Router are
+// grouped by provider. A client implementing BatchVersioner is asked in a single batch call, unless
+// it reports errors.ErrUnsupported. Otherwise every secret is looked up with its own GetSecretVersion
+// call, running up to limit calls in parallel. Every call or batch gets its own timeout.
+// Versions that could be retrieved are returned even if others failed.
+func GetSecretVersions(ctx context.Context, client Client, ids []string, limit int, timeout time.Duration) (map[string]string, error) {
+	versions := make(map[string]string, len(ids))
+	var errs []error
+	if r, ok := client.(Router); ok {
+		var order []string
+		groups := make(map[string][]string)
+		clients := make(map[string]Client)
+		for _, id := range ids {
+			provider, c, err := r.Route(id)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if _, ok := groups[provider]; !ok {
+				order = append(order, provider)
+				clients[provider] = c
+			}
+			groups[provider] = append(groups[provider], id)
+		}
+		for _, provider := range order {
+			v, err := GetSecretVersions(ctx, clients[provider], groups[provider], limit, timeout)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			maps.Copy(versions, v)
+		}
+		return versions, errors.Join(errs...)
+	}
+
+	if b, ok := client.(BatchVersioner); ok {
+		tctx, cancel := context.WithTimeout(ctx, timeout)
+		v, err := b.GetSecretVersions(tctx, ids)
+		cancel()
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return v, err
+		}
+	}
+
+	found := make([]string, len(ids))
+	for i, err := range forEach(limit, len(ids), func(i int) error {
+		tctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		v, err := client.GetSecretVersion(tctx, ids[i])
+		found[i] = v
+		return err
+	}) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ids[i], err))
+			continue
+		}
+		versions[ids[i]] = found[i]
+	}
+	return versions, errors.Join(errs...)
+}
+
+// Validator is implemented by clients that can reject identifiers they do not support
+// before any secret is retrieved.
+type Validator interface {
+	// ValidateIdentifier reports an error if the identifier cannot be served by the client.
+	ValidateIdentifier(id string) error
+}
+
 // Config holds configuration options for the SecretRetriever.
 type Config struct {
 	Frequency time.Duration
 	Timeout   time.Duration
 	Path      string
+	// SymlinkSwap publishes exploded secrets through an atomically swapped ..data symlink.
+	SymlinkSwap bool
+	// FileMode is the permission of written files for secrets that do not set their own.
+	FileMode os.FileMode
+	// Concurrency is the maximum number of secrets retrieved in parallel.
+	Concurrency int
+	// Retry controls how failed provider calls are retried.
+	Retry RetryPolicy
+	// FrequencyJitter shortens each interval between checks by up to this fraction at random.
+	FrequencyJitter float64
+	// Cache, when set, keeps the last retrieved values to fall back on when the provider is unavailable.
+	Cache *Cache
+	// Audit, when set, records every fetch, version change, write and cleanup.
+	Audit *audit.Log
 }
 
 // ConfigOption is a function that modifies Config.
@@ -46,19 +151,165 @@ func WithPath(path string) ConfigOption {
 	}
 }
 
+// WithSymlinkSwap enables the Kubernetes style ..data symlink swap for exploded secrets,
+// so that all files of a rotated secret change at the same time.
+func WithSymlinkSwap(enabled bool) ConfigOption {
+	return func(config *Config) {
+		config.SymlinkSwap = enabled
+	}
+}
+
+// WithFileMode sets the default permission of secret files.
+func WithFileMode(mode os.FileMode) ConfigOption {
+	return func(config *Config) {
+		config.FileMode = mode
+	}
+}
+
+// WithConcurrency sets the maximum number of secrets retrieved in parallel,
+// both at startup and when the Watcher refreshes changed secrets.
+func WithConcurrency(n int) ConfigOption {
+	return func(config *Config) {
+		config.Concurrency = n
+	}
+}
+
+// WithRetryPolicy sets how failed provider calls are retried.
+func WithRetryPolicy(policy RetryPolicy) ConfigOption {
+	return func(config *Config) {
+		config.Retry = policy
+	}
+}
+
+// WithFrequencyJitter randomly shortens each interval between checks by up to the given
+// fraction of the frequency, so that many instances do not poll the provider in lockstep.
+func WithFrequencyJitter(fraction float64) ConfigOption {
+	return func(config *Config) {
+		config.FrequencyJitter = fraction
+	}
+}
+
+// WithCache enables serving the last cached value of a secret when the provider is unavailable.
+func WithCache(cache *Cache) ConfigOption {
+	return func(config *Config) {
+		config.Cache = cache
+	}
+}
+
+// WithAudit records every fetch, version change, write and cleanup in the audit log.
+func WithAudit(log *audit.Log) ConfigOption {
+	return func(config *Config) {
+		config.Audit = log
+	}
+}
+
 // DefaultConfig returns a Config with default values.
 func DefaultConfig() *Config {
 	return &Config{
-		Frequency: 15 * time.Second,
-		Timeout:   10 * time.Second,
-		Path:      "/tmp",
+		Frequency:       15 * time.Second,
+		Timeout:         10 * time.Second,
+		Path:            "/tmp",
+		FileMode:        DefaultFileMode,
+		Concurrency:     DefaultConcurrency,
+		Retry:           DefaultRetryPolicy(),
+		FrequencyJitter: 0.1,
 	}
 }
 
 // Secret represents a secret that has been retrieved and stored.
+// Identifier names the secret at the provider and is used for version tracking, while Key
+// optionally selects a single field of a JSON secret to be stored instead of the whole value.
+// When the Key explodes the secret (see Exploded), Path names a directory holding one file per key.
+// Mode, UID and GID override the permissions and ownership of the written files, and OnChange
+// overrides how the application is notified when the secret changes. With InjectEnv the value is
+// placed in the environment variable EnvName instead of being written to Path.
+// Stale is set while the secret is served from the cache because the provider was unavailable.
 type Secret struct {
 	Identifier string
+	Key        string
 	EnvName    string
 	Version    string
 	Path       string
+	Mode       os.FileMode
+	UID        *int
+	GID        *int
+	OnChange   string
+	InjectEnv  bool
+	// Format is FormatRaw, or FormatBase64 to decode the value. Empty means raw.
+	Format string
+	// Refresh is how often the secret is checked for changes, when less often than the Watcher's
+	// frequency. Zero checks it on every tick.
+	Refresh time.Duration
+	// Source describes where the secret was declared, such as SECRETARY_DB_PASSWORD or
+	// secretary.yaml:12, for error messages.
+	Source string
+	Stale  bool
+
+	// envVar is the SECRETARY_ variable declaring the secret, unset once it was created.
+	envVar string
+
+	// files holds the names of the files written to Path for an exploded secret.
+	files []string
+	// lastChecked is when the secret was last confirmed current with the provider,
+	// and lastError the error of the latest failed check or retrieval.
+	lastChecked time.Time
+	lastError   error
+}
+
+// SecretStatus describes the state of a secret, without its value.
+type SecretStatus struct {
+	EnvName     string    `json:"env_name"`
+	Identifier  string    `json:"identifier"`
+	Key         string    `json:"key,omitempty"`
+	Version     string    `json:"version"`
+	LastChecked time.Time `json:"last_checked"`
+	LastError   string    `json:"last_error,omitempty"`
+	Stale       bool      `json:"stale"`
+	// Refresh is the refresh interval of the secret, zero when it is checked on every tick.
+	// It is encoded as a duration string such as "1h0m0s".
+	Refresh time.Duration `json:"-"`
+}
+
+// secretStatusJSON is the JSON form of SecretStatus.
+type secretStatusJSON struct {
+	secretStatus
+	Refresh string `json:"refresh,omitempty"`
+}
+
+// secretStatus has the fields of SecretStatus without its JSON methods.
+type secretStatus SecretStatus
+
+// MarshalJSON encodes the status with Refresh as a duration string.
+func (s SecretStatus) MarshalJSON() ([]byte, error) {
+	out := secretStatusJSON{secretStatus: secretStatus(s)}
+	if s.Refresh != 0 {
+		out.Refresh = s.Refresh.String()
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a status encoded by MarshalJSON.
+func (s *SecretStatus) UnmarshalJSON(data []byte) error {
+	var in secretStatusJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*s = SecretStatus(in.secretStatus)
+	if in.Refresh != "" {
+		refresh, err := time.ParseDuration(in.Refresh)
+		if err != nil {
+			return fmt.Errorf("refresh: %w", err)
+		}
+		s.Refresh = refresh
+	}
+	return nil
+}
+
+// Change describes the secrets and templates refreshed by a single watcher check.
+// SpanContext identifies the trace of the check, so that handling the change can be traced as part of it.
+type Change struct {
+	Time        time.Time
+	Secrets     []*Secret
+	Templates   []*Template
+	SpanContext trace.SpanContext
 }
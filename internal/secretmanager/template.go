@@ -0,0 +1,110 @@
+// Package secretmanager provides interfaces and implementations for secret management.
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"text/template"
+
+	"github.com/fr0stylo/secretary/internal/audit"
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/redact"
+	"github.com/fr0stylo/secretary/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Template renders a Go text/template file that references secrets into a destination file.
+// Inside the template, {{ secret "<identifier>" }} retrieves a secret through the Retriever's client
+// and {{ json "<key>" <value> }} selects a field of a JSON value, for example
+// {{ secret "arn:aws:secretsmanager:...:secret:prod/db" | json "password" }}.
+type Template struct {
+	Source      string
+	Destination string
+
+	// versions holds the version of every secret identifier referenced by the last render.
+	versions map[string]string
+}
+
+// NewTemplate creates a Template rendering the file at source into destination.
+func NewTemplate(source, destination string) *Template {
+	return &Template{
+		Source:      source,
+		Destination: destination,
+		versions:    make(map[string]string),
+	}
+}
+
+// CreateTemplate renders the template and writes the result to its destination.
+// The versions of all referenced secrets are recorded so the Watcher can re-render the
+// template whenever one of them changes.
+func (r *Retriever) CreateTemplate(ctx context.Context, t *Template) (err error) {
+	ctx, span := tracer.Start(ctx, "CreateTemplate", trace.WithAttributes(
+		attribute.String("secretary.template.source", t.Source),
+		attribute.String("secretary.template.destination", t.Destination),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	text, err := os.ReadFile(t.Source)
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[string]string)
+	values := make(map[string][]byte)
+	funcs := template.FuncMap{
+		"secret": func(declared string) (string, error) {
+			id, key := ParseIdentifier(declared)
+			value, ok := values[id]
+			if !ok {
+				entry, _, err := r.fetch(ctx, id)
+				if err != nil {
+					return "", err
+				}
+				value = entry.Value
+				versions[id] = entry.Version
+				values[id] = value
+			}
+			extracted, err := (&Secret{Identifier: id, Key: key}).Extract(value)
+			if err != nil {
+				return "", err
+			}
+			if key != "" {
+				redact.Put(declared, extracted)
+			}
+			return string(extracted), nil
+		},
+		"json": func(key string, value string) (string, error) {
+			extracted, err := (&Secret{Identifier: "value", Key: key}).Extract([]byte(value))
+			return string(extracted), err
+		},
+	}
+
+	tmpl, err := template.New(t.Source).Funcs(funcs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, nil); err != nil {
+		return fmt.Errorf("rendering template %s: %w", t.Source, err)
+	}
+
+	slog.Info("Rendering template", logging.Template, t.Source, logging.Path, t.Destination)
+	attrs := fileAttrs{mode: r.config.FileMode, uid: -1, gid: -1}
+	if err := writeFile(t.Destination, out.Bytes(), attrs); err != nil {
+		return err
+	}
+	r.config.Audit.Record(audit.Entry{Event: audit.EventWrite, Template: t.Source, Path: t.Destination, Fingerprint: r.config.Audit.Fingerprint(out.Bytes())})
+
+	t.versions = versions
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !slices.Contains(r.templates, t) {
+		r.templates = append(r.templates, t)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package secretmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testTemplate = `database:
+  user: {{ secret "prod/db#username" }}
+  password: {{ secret "prod/db" | json "password" }}
+api_key: {{ secret "prod/api" }}
+`
+
+func TestCreateTemplate(t *testing.T) {
+	client := NewMockClient()
+	client.SetSecretValue("prod/db", []byte(`{"username":"app","password":"s3cr3t"}`))
+	client.SetSecretVersion("prod/db", "v1")
+	client.SetSecretValue("prod/api", []byte("api-key"))
+	client.SetSecretVersion("prod/api", "v7")
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "config.yaml.tmpl")
+	if err := os.WriteFile(source, []byte(testTemplate), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	destination := filepath.Join(dir, "config.yaml")
+
+	retriever := NewRetriever(client, WithPath(dir))
+	tmpl := NewTemplate(source, destination)
+	if err := retriever.CreateTemplate(context.Background(), tmpl); err != nil {
+		t.Fatalf("CreateTemplate failed: %v", err)
+	}
+
+	content, err := os.ReadFile(destination)
+	if err != nil {
+		t.Fatalf("Failed to read rendered template: %v", err)
+	}
+	want := "database:\n  user: app\n  password: s3cr3t\napi_key: api-key\n"
+	if string(content) != want {
+		t.Errorf("Expected rendered template %q, got %q", want, content)
+	}
+
+	if len(tmpl.versions) != 2 || tmpl.versions["prod/db"] != "v1" || tmpl.versions["prod/api"] != "v7" {
+		t.Errorf("Unexpected recorded versions %v", tmpl.versions)
+	}
+
+	if err := retriever.Clean(); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if _, err := os.Stat(destination); !os.IsNotExist(err) {
+		t.Errorf("Expected rendered template to be removed, got %v", err)
+	}
+}
+
+func TestCreateTemplateMissingKey(t *testing.T) {
+	client := NewMockClient()
+	client.SetSecretValue("prod/db", []byte(`{"username":"app"}`))
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "config.tmpl")
+	if err := os.WriteFile(source, []byte(`{{ secret "prod/db" | json "password" }}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	retriever := NewRetriever(client)
+	if err := retriever.CreateTemplate(context.Background(), NewTemplate(source, filepath.Join(dir, "config"))); err == nil {
+		t.Error("Expected an error for a missing JSON key")
+	}
+}
+
+func TestWatcherRerendersTemplate(t *testing.T) {
+	client := NewMockClient()
+	client.SetSecretValue("prod/api", []byte("old-key"))
+	client.SetSecretVersion("prod/api", "v1")
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "config.tmpl")
+	if err := os.WriteFile(source, []byte(`key={{ secret "prod/api" }}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	destination := filepath.Join(dir, "config")
+
+	retriever := NewRetriever(client, WithFrequency(10*time.Millisecond))
+	if err := retriever.CreateTemplate(context.Background(), NewTemplate(source, destination)); err != nil {
+		t.Fatalf("CreateTemplate failed: %v", err)
+	}
+
+	watcher := NewWatcher(retriever)
+	changeCh := watcher.Start(context.Background())
+	defer watcher.Stop()
+
+	client.SetSecretValue("prod/api", []byte("new-key"))
+	client.SetSecretVersion("prod/api", "v2")
+
+	select {
+	case <-changeCh:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a change notification")
+	}
+
+	content, err := os.ReadFile(destination)
+	if err != nil {
+		t.Fatalf("Failed to read rendered template: %v", err)
+	}
+	if string(content) != "key=new-key" {
+		t.Errorf("Expected re-rendered template, got %q", content)
+	}
+}
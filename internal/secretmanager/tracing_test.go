@@ -0,0 +1,157 @@
+package secretmanager
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	exporterOnce sync.Once
+	exporter     *tracetest.InMemoryExporter
+)
+
+// recordSpans installs an in-memory span exporter as the global tracer provider, once per test
+// binary as the global provider can only be delegated to once, and clears it for the test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporterOnce.Do(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	})
+	exporter.Reset()
+	return exporter
+}
+
+func spanNamed(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func attr(span *tracetest.SpanStub, key attribute.Key) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestCreateSecretsFromEnvironmentSpans(t *testing.T) {
+	exp := recordSpans(t)
+	client := NewMockClient()
+	client.SetSecretValue("mock/db", []byte("value"))
+	client.SetSecretVersion("mock/db", "v7")
+	r := NewRetriever(client, WithPath(t.TempDir()))
+	defer r.Clean()
+
+	if err := r.CreateSecretsFromEnvironment(context.Background(), []string{"SECRETARY_TRACED=mock/db"}); err != nil {
+		t.Fatalf("CreateSecretsFromEnvironment failed: %v", err)
+	}
+
+	spans := exp.GetSpans()
+	root := spanNamed(spans, "CreateSecretsFromEnvironment")
+	create := spanNamed(spans, "CreateSecret")
+	version := spanNamed(spans, "GetSecretVersion")
+	value := spanNamed(spans, "GetSecretValue")
+	if root == nil || create == nil || version == nil || value == nil {
+		t.Fatalf("Expected retrieval spans, got %d spans", len(spans))
+	}
+	if create.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Error("Expected CreateSecret to be a child of CreateSecretsFromEnvironment")
+	}
+	if version.Parent.SpanID() != create.SpanContext.SpanID() || value.Parent.SpanID() != create.SpanContext.SpanID() {
+		t.Error("Expected the version check and value fetch to be children of CreateSecret")
+	}
+	if got := attr(create, "secretary.secret.identifier"); got != "mock/db" {
+		t.Errorf("Expected identifier attribute mock/db, got %q", got)
+	}
+	if got := attr(create, "secretary.secret.version"); got != "v7" {
+		t.Errorf("Expected version attribute v7, got %q", got)
+	}
+	if got := attr(create, "secretary.outcome"); got != "success" {
+		t.Errorf("Expected outcome success, got %q", got)
+	}
+}
+
+func TestCreateSecretsSpan(t *testing.T) {
+	exp := recordSpans(t)
+	client := NewMockClient()
+	client.SetSecretValue("mock/db", []byte("value"))
+	r := NewRetriever(client, WithPath(t.TempDir()))
+	defer r.Clean()
+
+	if err := r.CreateSecrets(context.Background(), []*Secret{{Identifier: "mock/db", EnvName: "TRACED", Path: filepath.Join(r.config.Path, "TRACED")}}); err != nil {
+		t.Fatalf("CreateSecrets failed: %v", err)
+	}
+
+	spans := exp.GetSpans()
+	root := spanNamed(spans, "CreateSecrets")
+	create := spanNamed(spans, "CreateSecret")
+	if root == nil || create == nil {
+		t.Fatalf("Expected retrieval spans, got %d spans", len(spans))
+	}
+	if create.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Error("Expected CreateSecret to be a child of CreateSecrets")
+	}
+	if got := attr(root, "secretary.secrets"); got != "1" {
+		t.Errorf("Expected 1 secret, got %q", got)
+	}
+}
+
+func TestCreateSecretErrorSpan(t *testing.T) {
+	exp := recordSpans(t)
+	client := &flakyClient{MockClient: NewMockClient(), failures: 2, err: statusError(http.StatusServiceUnavailable)}
+	r := NewRetriever(client, WithPath(t.TempDir()), WithRetryPolicy(fastRetry(2)))
+
+	if err := r.CreateSecret(context.Background(), &Secret{Identifier: "mock/db", EnvName: "TRACED"}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	spans := exp.GetSpans()
+	create := spanNamed(spans, "CreateSecret")
+	version := spanNamed(spans, "GetSecretVersion")
+	if create == nil || version == nil {
+		t.Fatalf("Expected retrieval spans, got %d spans", len(spans))
+	}
+	if got := attr(create, "secretary.outcome"); got != "error" {
+		t.Errorf("Expected outcome error, got %q", got)
+	}
+	if len(version.Events) == 0 || version.Events[0].Name != "retry" {
+		t.Errorf("Expected a retry event on the version check, got %v", version.Events)
+	}
+}
+
+func TestWatcherCheckSpan(t *testing.T) {
+	exp := recordSpans(t)
+	client := NewMockClient()
+	client.SetSecretValue("id-a", []byte(`{"user":"admin"}`))
+	r := NewRetriever(client, WithPath(t.TempDir()))
+	createWatchedSecrets(t, r)
+	exp.Reset()
+
+	client.SetSecretVersion("id-b", "v2")
+	change := NewWatcher(r).check(context.Background())
+
+	check := spanNamed(exp.GetSpans(), "WatcherCheck")
+	if check == nil {
+		t.Fatal("Expected a WatcherCheck span")
+	}
+	if change.SpanContext.SpanID() != check.SpanContext.SpanID() {
+		t.Error("Expected the change to carry the span context of the check")
+	}
+	if got := attr(check, "secretary.secrets.changed"); got != "1" {
+		t.Errorf("Expected 1 changed secret, got %q", got)
+	}
+}
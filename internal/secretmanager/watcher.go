@@ -3,12 +3,20 @@ package secretmanager
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
+	"slices"
 	"time"
+
+	"github.com/fr0stylo/secretary/internal/audit"
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Watcher monitors secrets for changes and triggers updates when they change.
 // It periodically checks the version of each secret and recreates it if the version has changed.
+// Templates are re-rendered whenever any secret they reference changes.
 type Watcher struct {
 	r      *Retriever
 	cancel context.CancelFunc
@@ -20,39 +28,32 @@ func NewWatcher(retriever *Retriever) *Watcher {
 	return &Watcher{r: retriever}
 }
 
-// Start begins watching for secret changes at the frequency specified in the Retriever's config.
-// It returns a channel that will receive a timestamp string whenever a secret changes.
+// Start begins watching for secret changes at the frequency specified in the Retriever's config,
+// shortened at random by up to the configured frequency jitter.
+// It returns a channel that will receive a Change describing the refreshed secrets and templates
+// whenever something changes.
 // The context can be used to stop the watcher, or the Stop method can be called.
-func (w *Watcher) Start(ctx context.Context) chan string {
-	t := time.NewTicker(w.r.config.Frequency)
-	changeCh := make(chan string)
+func (w *Watcher) Start(ctx context.Context) chan Change {
+	t := time.NewTimer(jitter(w.r.config.Frequency, w.r.config.FrequencyJitter))
+	changeCh := make(chan Change)
 	ctx, cancel := context.WithCancel(ctx)
 	w.cancel = cancel
 	go func() {
+		defer t.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-t.C:
-				found := false
-				for _, secret := range w.r.pulledVersions {
-					v, err := w.r.client.GetSecretVersion(ctx, secret.Identifier)
-					if err != nil {
-						log.Printf("Error retrieving secret version: %s", err)
-						continue
-					}
-					if v == secret.Version {
-						continue
-					}
-					log.Printf("Secret %s changed, recreating", secret.Identifier)
-					found = true
-					if err := w.r.CreateSecret(ctx, secret); err != nil {
-						log.Printf("Error creating secret: %s", err)
-						continue
-					}
+				change := w.check(ctx)
+				t.Reset(jitter(w.r.config.Frequency, w.r.config.FrequencyJitter))
+				if len(change.Secrets) == 0 && len(change.Templates) == 0 {
+					continue
 				}
-				if found {
-					changeCh <- time.Now().String()
+				select {
+				case changeCh <- change:
+				case <-ctx.Done():
+					return
 				}
 			}
 		}
@@ -60,6 +61,114 @@ func (w *Watcher) Start(ctx context.Context) chan string {
 	return changeCh
 }
 
+// check compares the current version of every watched secret with the one last retrieved,
+// recreating changed secrets and re-rendering templates that reference them.
+func (w *Watcher) check(ctx context.Context) (change Change) {
+	ctx, span := tracer.Start(ctx, "WatcherCheck")
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("secretary.secrets.changed", len(change.Secrets)),
+			attribute.Int("secretary.templates.changed", len(change.Templates)),
+		)
+		span.End()
+		slog.DebugContext(ctx, "Checked secret versions",
+			logging.Duration, time.Since(change.Time),
+			"changed_secrets", len(change.Secrets),
+			"changed_templates", len(change.Templates),
+		)
+	}()
+	change = Change{Time: time.Now(), SpanContext: span.SpanContext()}
+
+	// Several secrets and templates may reference the same parent secret,
+	// so each identifier is only checked once per tick, in a single batch where supported.
+	// Secrets with a refresh interval are only checked once it elapsed, along with every
+	// other secret sharing their identifier.
+	secrets, templates := w.r.Secrets(), w.r.Templates()
+	var ids []string
+	for _, secret := range secrets {
+		if w.r.due(secret, change.Time) && !slices.Contains(ids, secret.Identifier) {
+			ids = append(ids, secret.Identifier)
+		}
+	}
+	for _, t := range templates {
+		for id := range t.versions {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		// No secret is due: every secret is as current as its refresh interval requires.
+		metrics.LastRefresh.SetToCurrentTime()
+		return change
+	}
+	secrets = slices.DeleteFunc(secrets, func(s *Secret) bool {
+		return !slices.Contains(ids, s.Identifier)
+	})
+	versions, err := GetSecretVersions(ctx, w.r.client, ids, w.r.config.Concurrency, w.r.config.Timeout)
+	if err != nil {
+		slog.Error("Error retrieving secret versions", logging.Err(err))
+	} else {
+		metrics.LastRefresh.SetToCurrentTime()
+	}
+	for _, id := range ids {
+		if _, ok := versions[id]; !ok {
+			metrics.VersionCheckErrors.WithLabelValues(metrics.HashIdentifier(id)).Inc()
+		}
+	}
+	rotated := make(map[string]bool)
+	rotation := func(id, previous, current string) {
+		if !rotated[id] {
+			rotated[id] = true
+			metrics.Rotations.WithLabelValues(metrics.HashIdentifier(id)).Inc()
+			w.r.config.Audit.Record(audit.Entry{Event: audit.EventVersionChange, Identifier: id, PreviousVersion: previous, Version: current})
+		}
+	}
+
+	for _, secret := range secrets {
+		v, ok := versions[secret.Identifier]
+		if !ok {
+			if err == nil {
+				err = errors.New("no version returned by the provider")
+			}
+			w.r.checked(secret, err)
+			continue
+		}
+		if v == secret.Version {
+			w.r.checked(secret, nil)
+			continue
+		}
+		slog.Info("Secret changed, recreating", logging.Identifier, secret.Identifier, logging.EnvName, secret.EnvName, "previous_version", secret.Version, logging.Version, v)
+		rotation(secret.Identifier, secret.Version, v)
+		change.Secrets = append(change.Secrets, secret)
+	}
+	errs := forEach(w.r.config.Concurrency, len(change.Secrets), func(i int) error {
+		return w.r.CreateSecret(ctx, change.Secrets[i])
+	})
+	for _, err := range errs {
+		if err != nil {
+			slog.Error("Error creating secret", logging.Err(err))
+		}
+	}
+
+	for _, t := range templates {
+		for id, version := range t.versions {
+			v, ok := versions[id]
+			if !ok || v == version {
+				continue
+			}
+			slog.Info("Secret referenced by template changed, re-rendering", logging.Identifier, id, logging.Template, t.Source, "previous_version", version, logging.Version, v)
+			rotation(id, version, v)
+			change.Templates = append(change.Templates, t)
+			if err := w.r.CreateTemplate(ctx, t); err != nil {
+				slog.Error("Error rendering template", logging.Template, t.Source, logging.Err(err))
+			}
+			break
+		}
+	}
+	return change
+}
+
 // Stop halts the watcher's goroutine.
 // This should be called when the watcher is no longer needed to prevent resource leaks.
 func (w *Watcher) Stop() {
@@ -0,0 +1,234 @@
+package secretmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/metrics"
+	"github.com/fr0stylo/secretary/internal/redact"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countingClient wraps MockClient and counts version lookups.
+type countingClient struct {
+	*MockClient
+	mu            sync.Mutex
+	versionCalls  int
+	batchCalls    int
+	batchRequests [][]string
+}
+
+func (c *countingClient) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	c.mu.Lock()
+	c.versionCalls++
+	c.mu.Unlock()
+	return c.MockClient.GetSecretVersion(ctx, id)
+}
+
+// batchingClient additionally implements BatchVersioner.
+type batchingClient struct {
+	*countingClient
+}
+
+func (c batchingClient) GetSecretVersions(ctx context.Context, ids []string) (map[string]string, error) {
+	c.mu.Lock()
+	c.batchCalls++
+	c.batchRequests = append(c.batchRequests, slices.Clone(ids))
+	c.mu.Unlock()
+	versions := make(map[string]string, len(ids))
+	for _, id := range ids {
+		v, _ := c.MockClient.GetSecretVersion(ctx, id)
+		versions[id] = v
+	}
+	return versions, nil
+}
+
+func createWatchedSecrets(t *testing.T, r *Retriever) {
+	t.Helper()
+	for _, s := range []*Secret{
+		{Identifier: "id-a", EnvName: "WATCH_A", Path: filepath.Join(r.config.Path, "WATCH_A")},
+		{Identifier: "id-b", EnvName: "WATCH_B", Path: filepath.Join(r.config.Path, "WATCH_B")},
+		{Identifier: "id-a", Key: "user", EnvName: "WATCH_C", Path: filepath.Join(r.config.Path, "WATCH_C")},
+	} {
+		if err := r.CreateSecret(context.Background(), s); err != nil {
+			t.Fatalf("CreateSecret failed: %v", err)
+		}
+	}
+	t.Cleanup(func() { r.Clean() })
+}
+
+func TestWatcherUsesBatchVersioner(t *testing.T) {
+	mock := NewMockClient()
+	mock.SetSecretValue("id-a", []byte(`{"user":"admin"}`))
+	mock.SetSecretValue("id-b", []byte("b"))
+	client := batchingClient{&countingClient{MockClient: mock}}
+	r := NewRetriever(client, WithPath(t.TempDir()))
+	createWatchedSecrets(t, r)
+	client.versionCalls = 0
+
+	w := NewWatcher(r)
+	if change := w.check(context.Background()); len(change.Secrets) != 0 {
+		t.Errorf("Expected no changes, got %v", change.Secrets)
+	}
+	if client.versionCalls != 0 {
+		t.Errorf("Expected no individual version calls, got %d", client.versionCalls)
+	}
+	if client.batchCalls != 1 {
+		t.Fatalf("Expected 1 batch call, got %d", client.batchCalls)
+	}
+	if want := []string{"id-a", "id-b"}; !slices.Equal(client.batchRequests[0], want) {
+		t.Errorf("Expected batch request %v, got %v", want, client.batchRequests[0])
+	}
+
+	mock.SetSecretVersion("id-b", "v2")
+	if change := w.check(context.Background()); len(change.Secrets) != 1 || change.Secrets[0].EnvName != "WATCH_B" {
+		t.Errorf("Expected only WATCH_B to change, got %v", change.Secrets)
+	}
+}
+
+func TestWatcherFallsBackToPerSecretVersions(t *testing.T) {
+	mock := NewMockClient()
+	mock.SetSecretValue("id-a", []byte(`{"user":"admin"}`))
+	mock.SetSecretValue("id-b", []byte("b"))
+	client := &countingClient{MockClient: mock}
+	r := NewRetriever(client, WithPath(t.TempDir()))
+	createWatchedSecrets(t, r)
+	client.versionCalls = 0
+
+	w := NewWatcher(r)
+	if change := w.check(context.Background()); len(change.Secrets) != 0 {
+		t.Errorf("Expected no changes, got %v", change.Secrets)
+	}
+	if client.versionCalls != 2 {
+		t.Errorf("Expected 2 version calls for 2 unique identifiers, got %d", client.versionCalls)
+	}
+
+	mock.SetSecretVersion("id-a", "v2")
+	if change := w.check(context.Background()); len(change.Secrets) != 2 {
+		t.Errorf("Expected both secrets of id-a to change, got %d", len(change.Secrets))
+	}
+}
+
+func TestWatcherUpdatesRedactedValues(t *testing.T) {
+	mock := NewMockClient()
+	mock.SetSecretValue("rotating", []byte("Xk29fPq1-old"))
+	mock.SetSecretVersion("rotating", "v1")
+	dir := t.TempDir()
+	r := NewRetriever(mock, WithPath(dir))
+	defer r.Clean()
+	if err := r.CreateSecret(context.Background(), &Secret{Identifier: "rotating", EnvName: "ROTATING", Path: filepath.Join(dir, "ROTATING")}); err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+
+	mock.SetSecretValue("rotating", []byte("Lm47tRw8-new"))
+	mock.SetSecretVersion("rotating", "v2")
+	NewWatcher(r).check(context.Background())
+
+	if got := redact.String("Lm47tRw8-new"); got != redact.Mask {
+		t.Errorf("Expected the rotated value to be redacted, got %q", got)
+	}
+	if got := redact.String("Xk29fPq1-old"); got != redact.Mask {
+		t.Errorf("Expected the previous value to stay redacted until the reload, got %q", got)
+	}
+	redact.Default.Release(redact.Default.Generation())
+	if got := redact.String("Xk29fPq1-old"); got != "Xk29fPq1-old" {
+		t.Errorf("Expected the previous value to be released, got %q", got)
+	}
+}
+
+func TestWatcherHonoursRefresh(t *testing.T) {
+	mock := NewMockClient()
+	mock.SetSecretValue("id-a", []byte(`{"user":"admin"}`))
+	mock.SetSecretValue("id-b", []byte("b"))
+	client := batchingClient{&countingClient{MockClient: mock}}
+	r := NewRetriever(client, WithPath(t.TempDir()))
+	createWatchedSecrets(t, r)
+	for _, s := range r.Secrets() {
+		if s.Identifier == "id-a" {
+			s.Refresh = time.Hour
+		}
+	}
+
+	mock.SetSecretVersion("id-a", "v2")
+	w := NewWatcher(r)
+	if change := w.check(context.Background()); len(change.Secrets) != 0 {
+		t.Errorf("Expected id-a not to be checked before its refresh interval, got %v", change.Secrets)
+	}
+	if want := []string{"id-b"}; !slices.Equal(client.batchRequests[0], want) {
+		t.Errorf("Expected batch request %v, got %v", want, client.batchRequests[0])
+	}
+
+	// Once one secret of id-a is due, every secret sharing the identifier is checked.
+	r.mu.Lock()
+	for _, s := range r.pulledVersions {
+		if s.EnvName == "WATCH_A" {
+			s.lastChecked = time.Now().Add(-2 * time.Hour)
+		}
+	}
+	r.mu.Unlock()
+	if change := w.check(context.Background()); len(change.Secrets) != 2 {
+		t.Errorf("Expected both secrets of id-a to change, got %v", change.Secrets)
+	}
+
+	// A check where no secret is due still counts as a successful refresh.
+	for _, s := range r.Secrets() {
+		s.Refresh = time.Hour
+	}
+	metrics.LastRefresh.Set(0)
+	w.check(context.Background())
+	if testutil.ToFloat64(metrics.LastRefresh) == 0 {
+		t.Error("Expected the last refresh time to be updated when no secret is due")
+	}
+}
+
+// unbatchedClient takes delay to look up every version, or fails batch lookups as unsupported.
+type unbatchedClient struct {
+	*countingClient
+	delay time.Duration
+}
+
+func (c unbatchedClient) GetSecretVersion(ctx context.Context, id string) (string, error) {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return c.countingClient.GetSecretVersion(ctx, id)
+}
+
+func (c unbatchedClient) GetSecretVersions(ctx context.Context, ids []string) (map[string]string, error) {
+	c.mu.Lock()
+	c.batchCalls++
+	c.mu.Unlock()
+	return nil, fmt.Errorf("batch lookup denied: %w", errors.ErrUnsupported)
+}
+
+func TestGetSecretVersionsInParallel(t *testing.T) {
+	mock := NewMockClient()
+	var ids []string
+	for i := range 8 {
+		id := fmt.Sprintf("id-%d", i)
+		mock.SetSecretVersion(id, "v1")
+		ids = append(ids, id)
+	}
+	client := unbatchedClient{countingClient: &countingClient{MockClient: mock}, delay: 50 * time.Millisecond}
+
+	// One after another, the lookups would take 400ms. In parallel, each within its own
+	// timeout, they all succeed.
+	versions, err := GetSecretVersions(context.Background(), client, ids, 4, 80*time.Millisecond)
+	if err != nil {
+		t.Fatalf("GetSecretVersions failed: %v", err)
+	}
+	if len(versions) != len(ids) {
+		t.Errorf("Expected %d versions, got %v", len(ids), versions)
+	}
+	if client.batchCalls != 1 || client.versionCalls != len(ids) {
+		t.Errorf("Expected the unsupported batch to fall back to %d lookups, got %d batches and %d lookups", len(ids), client.batchCalls, client.versionCalls)
+	}
+}
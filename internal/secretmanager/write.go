@@ -0,0 +1,222 @@
+// Package secretmanager provides interfaces and implementations for secret management.
+package secretmanager
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dataDir is the symlink pointing at the current generation of an exploded secret when
+// symlink swapping is enabled, following the layout of Kubernetes secret volumes.
+const dataDir = "..data"
+
+// writeFile atomically replaces the file at p with content. The content is written to a
+// temporary file in the same directory, synced to disk and renamed over p, so readers see
+// either the previous or the new content and never a partially written file. Permissions
+// and ownership are applied before the rename, so the file is never exposed with others.
+func writeFile(p string, content []byte, attrs fileAttrs) error {
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err := f.Chmod(attrs.mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := attrs.chown(tmp); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(p))
+}
+
+// syncDir flushes directory metadata, such as a rename, to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// writeDir writes one file per key of an exploded secret into the directory at secret.Path,
+// removing files for keys that are no longer present in the secret. With swap enabled, see
+// writeDirSwap, all files are replaced at once.
+func writeDir(secret *Secret, files map[string][]byte, attrs fileAttrs, swap bool) error {
+	if err := mkdir(secret.Path, attrs); err != nil {
+		return err
+	}
+	if swap {
+		return writeDirSwap(secret, files, attrs)
+	}
+
+	names := make([]string, 0, len(files))
+	for name, content := range files {
+		if err := writeFile(filepath.Join(secret.Path, name), content, attrs); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	if err := removeStale(secret, files, ""); err != nil {
+		return err
+	}
+	secret.files = names
+	return nil
+}
+
+// writeDirSwap writes the files of an exploded secret into a new timestamped generation
+// directory and atomically repoints the ..data symlink at it. Every key is exposed as a
+// symlink through ..data, so readers observe all keys of a rotation at the same time.
+func writeDirSwap(secret *Secret, files map[string][]byte, attrs fileAttrs) error {
+	generation, err := os.MkdirTemp(secret.Path, time.Now().UTC().Format("..2006_01_02_15_04_05."))
+	if err != nil {
+		return err
+	}
+	if err := setDirAttrs(generation, attrs); err != nil {
+		os.RemoveAll(generation)
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name, content := range files {
+		if err := writeFile(filepath.Join(generation, name), content, attrs); err != nil {
+			os.RemoveAll(generation)
+			return err
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	current := filepath.Join(secret.Path, dataDir)
+	previous, _ := os.Readlink(current)
+
+	tmpLink := filepath.Join(secret.Path, dataDir+"_tmp")
+	if err := os.Remove(tmpLink); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(generation)
+		return err
+	}
+	if err := os.Symlink(filepath.Base(generation), tmpLink); err != nil {
+		os.RemoveAll(generation)
+		return err
+	}
+	if err := attrs.chown(tmpLink); err != nil {
+		os.RemoveAll(generation)
+		return err
+	}
+	if err := os.Rename(tmpLink, current); err != nil {
+		os.RemoveAll(generation)
+		return err
+	}
+
+	for _, name := range names {
+		link, target := filepath.Join(secret.Path, name), filepath.Join(dataDir, name)
+		if current, err := os.Readlink(link); err == nil && current == target {
+			continue
+		}
+		// Anything else at the name was left by an earlier writer.
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+		if err := attrs.chown(link); err != nil {
+			return err
+		}
+	}
+	if err := removeStale(secret, files, filepath.Base(generation)); err != nil {
+		return err
+	}
+	secret.files = names
+
+	if previous != "" && previous != filepath.Base(generation) {
+		if err := os.RemoveAll(filepath.Join(secret.Path, previous)); err != nil {
+			return err
+		}
+	}
+	return syncDir(secret.Path)
+}
+
+// mkdir creates the directory of an exploded secret with permissions derived from the file mode.
+func mkdir(dir string, attrs fileAttrs) error {
+	if err := os.MkdirAll(dir, attrs.dirMode()); err != nil {
+		return err
+	}
+	return setDirAttrs(dir, attrs)
+}
+
+// setDirAttrs applies the permissions and ownership derived from attrs to an existing directory.
+func setDirAttrs(dir string, attrs fileAttrs) error {
+	if err := os.Chmod(dir, attrs.dirMode()); err != nil {
+		return err
+	}
+	return attrs.chown(dir)
+}
+
+// removeStale removes the files of keys that were written previously but are no longer part of the secret.
+// On the first write, nothing is known about the files already in the directory, for example from a
+// previous run, so every file and symlink that is not a key of the secret is removed, along with the
+// generation directories other than the current one. Other directories are left alone.
+func removeStale(secret *Secret, files map[string][]byte, generation string) error {
+	if secret.files == nil {
+		return removeUnknown(secret.Path, files, generation)
+	}
+	for _, name := range secret.files {
+		if _, ok := files[name]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(secret.Path, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUnknown removes the entries of dir left by an earlier writer, see removeStale.
+func removeUnknown(dir string, files map[string][]byte, generation string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := files[name]; ok || name == generation || (generation != "" && name == dataDir) {
+			continue
+		}
+		switch {
+		case !entry.IsDir():
+			err = os.Remove(filepath.Join(dir, name))
+		case strings.HasPrefix(name, ".."):
+			err = os.RemoveAll(filepath.Join(dir, name))
+		default:
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
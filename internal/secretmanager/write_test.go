@@ -0,0 +1,122 @@
+package secretmanager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileReplacesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "secret")
+
+	if err := writeFile(p, []byte("first"), fileAttrs{mode: DefaultFileMode, uid: -1, gid: -1}); err != nil {
+		t.Fatalf("writeFile failed: %v", err)
+	}
+	if err := writeFile(p, []byte("second"), fileAttrs{mode: DefaultFileMode, uid: -1, gid: -1}); err != nil {
+		t.Fatalf("writeFile failed: %v", err)
+	}
+
+	content, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "second" {
+		t.Errorf("Expected 'second', got '%s'", content)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected temporary files to be cleaned up, found %d entries", len(entries))
+	}
+}
+
+func TestWriteDirSymlinkSwap(t *testing.T) {
+	secret := &Secret{Identifier: "test", Key: "*", Path: filepath.Join(t.TempDir(), "DB")}
+
+	if err := writeDir(secret, map[string][]byte{"username": []byte("app"), "password": []byte("one")}, fileAttrs{mode: DefaultFileMode, uid: -1, gid: -1}, true); err != nil {
+		t.Fatalf("writeDir failed: %v", err)
+	}
+	firstGeneration, err := os.Readlink(filepath.Join(secret.Path, dataDir))
+	if err != nil {
+		t.Fatalf("Expected %s to be a symlink: %v", dataDir, err)
+	}
+
+	link, err := os.Readlink(filepath.Join(secret.Path, "password"))
+	if err != nil || link != filepath.Join(dataDir, "password") {
+		t.Errorf("Expected password to link through %s, got %s (%v)", dataDir, link, err)
+	}
+
+	if err := writeDir(secret, map[string][]byte{"username": []byte("app"), "token": []byte("two")}, fileAttrs{mode: DefaultFileMode, uid: -1, gid: -1}, true); err != nil {
+		t.Fatalf("writeDir failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(secret.Path, "token"))
+	if err != nil || string(content) != "two" {
+		t.Errorf("Expected token to contain 'two', got '%s' (%v)", content, err)
+	}
+	if _, err := os.Lstat(filepath.Join(secret.Path, "password")); !os.IsNotExist(err) {
+		t.Errorf("Expected password link to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(secret.Path, firstGeneration)); !os.IsNotExist(err) {
+		t.Errorf("Expected previous generation %s to be removed, got %v", firstGeneration, err)
+	}
+
+	entries, err := os.ReadDir(secret.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generations := 0
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "..") && e.Name() != dataDir {
+			generations++
+		}
+	}
+	if generations != 1 {
+		t.Errorf("Expected exactly one generation directory, got %d", generations)
+	}
+}
+
+func TestWriteDirRemovesUnknownFilesOnFirstWrite(t *testing.T) {
+	for _, swap := range []bool{false, true} {
+		dir := filepath.Join(t.TempDir(), "DB")
+		for _, p := range []string{filepath.Join(dir, "..2024_01_01_00_00_00.1"), filepath.Join(dir, "keep")} {
+			if err := os.MkdirAll(p, 0o700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, name := range []string{"old-key", "password"} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("previous run"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Symlink("..2024_01_01_00_00_00.1", filepath.Join(dir, dataDir)); err != nil {
+			t.Fatal(err)
+		}
+
+		secret := &Secret{Identifier: "test", Key: "*", Path: dir}
+		if err := writeDir(secret, map[string][]byte{"password": []byte("current")}, fileAttrs{mode: DefaultFileMode, uid: -1, gid: -1}, swap); err != nil {
+			t.Fatalf("writeDir failed: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, "password"))
+		if err != nil || string(content) != "current" {
+			t.Errorf("swap=%v: expected password to contain 'current', got '%s' (%v)", swap, content, err)
+		}
+		for _, name := range []string{"old-key", "..2024_01_01_00_00_00.1"} {
+			if _, err := os.Lstat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+				t.Errorf("swap=%v: expected %s to be removed, got %v", swap, name, err)
+			}
+		}
+		if _, err := os.Lstat(filepath.Join(dir, dataDir)); swap == os.IsNotExist(err) {
+			t.Errorf("swap=%v: unexpected %s state: %v", swap, dataDir, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "keep")); err != nil {
+			t.Errorf("swap=%v: expected other directories to be left alone, got %v", swap, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package supervisor
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/redact"
+)
+
+// OutputMask replaces secret values in the output of the application.
+const OutputMask = "***"
+
+// outputDrainTimeout is how long the output of an exited process is waited for. Descendants
+// that inherited its stdout or stderr may keep the streams open after it exited.
+const outputDrainTimeout = time.Second
+
+// redactedOutput streams the stdout and stderr of a process to secretary's own through writers
+// masking secret values.
+type redactedOutput struct {
+	writeEnds []*os.File
+	wg        sync.WaitGroup
+}
+
+// redactOutput connects the stdout and stderr of cmd to pipes redacted with set.
+func redactOutput(cmd *exec.Cmd, set *redact.Set) (*redactedOutput, error) {
+	o := &redactedOutput{}
+	for _, stream := range []struct {
+		dst *os.File
+		src *io.Writer
+	}{{os.Stdout, &cmd.Stdout}, {os.Stderr, &cmd.Stderr}} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			o.started()
+			return nil, err
+		}
+		*stream.src = w
+		o.writeEnds = append(o.writeEnds, w)
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			defer r.Close()
+			rw := redact.NewWriter(stream.dst, set, OutputMask)
+			if _, err := io.Copy(rw, r); err != nil {
+				slog.Error("Error copying application output", logging.Err(err))
+			}
+			rw.Flush()
+		}()
+	}
+	return o, nil
+}
+
+// started closes the write ends of the pipes held by secretary once the process started, or
+// failed to, so that the streams end when the process and its descendants close them.
+func (o *redactedOutput) started() {
+	for _, w := range o.writeEnds {
+		w.Close()
+	}
+}
+
+// drain waits for the output of the exited process to be written, up to outputDrainTimeout.
+func (o *redactedOutput) drain() {
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(outputDrainTimeout):
+	}
+}
@@ -0,0 +1,64 @@
+package supervisor
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/redact"
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+)
+
+// captureOutput redirects secretary's stdout and stderr to files for the duration of the test.
+func captureOutput(t *testing.T) (stdout, stderr string) {
+	t.Helper()
+	dir := t.TempDir()
+	stdout, stderr = filepath.Join(dir, "stdout"), filepath.Join(dir, "stderr")
+	for _, stream := range []struct {
+		f    **os.File
+		path string
+	}{{&os.Stdout, stdout}, {&os.Stderr, stderr}} {
+		f, err := os.Create(stream.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		previous := *stream.f
+		*stream.f = f
+		t.Cleanup(func() {
+			*stream.f = previous
+			f.Close()
+		})
+	}
+	return stdout, stderr
+}
+
+func TestRunRedactsOutput(t *testing.T) {
+	const value = "correct-horse-battery-staple"
+	set := redact.New()
+	set.Put("id", []byte(value))
+	stdout, stderr := captureOutput(t)
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(value))
+	script := `printf 'password=%s\n' ` + value + `; echo "token ` + encoded + `" >&2`
+	result := run(New([]string{"sh", "-c", script}, WithRedactedOutput(set)), make(chan os.Signal), make(chan secretmanager.Change))
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervisor did not return")
+	}
+
+	for path, want := range map[string]string{stdout: "password=***\n", stderr: "token ***\n"} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
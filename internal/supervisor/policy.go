@@ -0,0 +1,136 @@
+// Package supervisor runs the wrapped application and relays signals and secret changes to it.
+package supervisor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// Action is what the supervisor does to the application when a secret changes.
+type Action int
+
+const (
+	// ActionSignal sends a signal to the application.
+	ActionSignal Action = iota
+	// ActionRestart gracefully stops the application and starts it again.
+	ActionRestart
+	// ActionExec runs a hook command, such as nginx -s reload.
+	ActionExec
+	// ActionNone leaves the application alone.
+	ActionNone
+)
+
+// Policy describes how the application is notified about a secret change.
+type Policy struct {
+	Action  Action
+	Signal  syscall.Signal
+	Command []string
+}
+
+// DefaultPolicy sends SIGHUP to the application.
+var DefaultPolicy = Policy{Action: ActionSignal, Signal: syscall.SIGHUP}
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"TERM":  syscall.SIGTERM,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"WINCH": syscall.SIGWINCH,
+	"ALRM":  syscall.SIGALRM,
+}
+
+// ParseSignal parses a signal name such as SIGUSR1 or USR1.
+func ParseSignal(name string) (syscall.Signal, error) {
+	sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal %q", name)
+	}
+	return sig, nil
+}
+
+// signalName returns the name of a signal such as SIGHUP, or its number when it has no known name.
+func signalName(sig syscall.Signal) string {
+	if sig == syscall.SIGKILL {
+		return "SIGKILL"
+	}
+	for name, s := range signalNames {
+		if s == sig {
+			return "SIG" + name
+		}
+	}
+	return fmt.Sprintf("%d", int(sig))
+}
+
+// ParsePolicy parses a reload policy. Accepted forms are:
+//
+//	signal             send SIGHUP
+//	signal:<SIGNAL>    send the named signal, e.g. signal:SIGUSR1
+//	restart            gracefully restart the application
+//	exec:<command>     run a command, split on whitespace, e.g. exec:nginx -s reload
+//	none               do nothing
+func ParsePolicy(value string) (Policy, error) {
+	kind, arg, hasArg := strings.Cut(value, ":")
+	switch kind {
+	case "signal":
+		if !hasArg {
+			return DefaultPolicy, nil
+		}
+		sig, err := ParseSignal(arg)
+		if err != nil {
+			return Policy{}, err
+		}
+		return Policy{Action: ActionSignal, Signal: sig}, nil
+	case "restart":
+		if hasArg {
+			return Policy{}, fmt.Errorf("restart policy does not take an argument, got %q", value)
+		}
+		return Policy{Action: ActionRestart}, nil
+	case "exec":
+		command := strings.Fields(arg)
+		if len(command) == 0 {
+			return Policy{}, fmt.Errorf("exec policy requires a command, e.g. exec:nginx -s reload")
+		}
+		return Policy{Action: ActionExec, Command: command}, nil
+	case "none":
+		if hasArg {
+			return Policy{}, fmt.Errorf("none policy does not take an argument, got %q", value)
+		}
+		return Policy{Action: ActionNone}, nil
+	}
+	return Policy{}, fmt.Errorf("unknown reload policy %q, expected signal[:<SIGNAL>], restart, exec:<command> or none", value)
+}
+
+// String returns the policy in the form accepted by ParsePolicy.
+func (p Policy) String() string {
+	switch p.Action {
+	case ActionSignal:
+		return "signal:" + signalName(p.Signal)
+	case ActionRestart:
+		return "restart"
+	case ActionExec:
+		return "exec:" + strings.Join(p.Command, " ")
+	}
+	return "none"
+}
+
+// combine merges the policies of all secrets changed at once. A restart covers every other
+// action; otherwise each distinct signal is sent and each distinct command is run once.
+func combine(policies []Policy) []Policy {
+	var combined []Policy
+	for _, p := range policies {
+		switch p.Action {
+		case ActionRestart:
+			return []Policy{p}
+		case ActionNone:
+			continue
+		}
+		if !slices.ContainsFunc(combined, func(c Policy) bool { return c.String() == p.String() }) {
+			combined = append(combined, p)
+		}
+	}
+	return combined
+}
@@ -0,0 +1,184 @@
+package supervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/redact"
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "signal", want: "signal:SIGHUP"},
+		{value: "signal:SIGUSR1", want: "signal:SIGUSR1"},
+		{value: "signal:usr2", want: "signal:SIGUSR2"},
+		{value: "restart", want: "restart"},
+		{value: "exec:nginx -s reload", want: "exec:nginx -s reload"},
+		{value: "none", want: "none"},
+	}
+	for _, tt := range tests {
+		p, err := ParsePolicy(tt.value)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.value, err)
+			continue
+		}
+		if p.String() != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.value, tt.want, p)
+		}
+	}
+
+	for _, value := range []string{"", "reload", "signal:SIGFOO", "exec:", "restart:now", "none:at-all"} {
+		if _, err := ParsePolicy(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestCombine(t *testing.T) {
+	hup := Policy{Action: ActionSignal, Signal: syscall.SIGHUP}
+	usr1 := Policy{Action: ActionSignal, Signal: syscall.SIGUSR1}
+	hook := Policy{Action: ActionExec, Command: []string{"reload"}}
+	none := Policy{Action: ActionNone}
+	restart := Policy{Action: ActionRestart}
+
+	got := combine([]Policy{hup, none, hup, usr1, hook, hook})
+	if len(got) != 3 || got[0].String() != hup.String() || got[1].String() != usr1.String() || got[2].String() != hook.String() {
+		t.Errorf("Expected distinct signal and hook policies, got %v", got)
+	}
+
+	got = combine([]Policy{hup, restart, hook})
+	if len(got) != 1 || got[0].Action != ActionRestart {
+		t.Errorf("Expected restart to cover every other action, got %v", got)
+	}
+
+	if got := combine([]Policy{none}); len(got) != 0 {
+		t.Errorf("Expected no actions, got %v", got)
+	}
+}
+
+func TestRunRestartPolicy(t *testing.T) {
+	dir := t.TempDir()
+	starts := filepath.Join(dir, "starts")
+	script := `echo start >> ` + starts + `; trap 'exit 0' TERM; while true; do sleep 0.05; done`
+
+	signals := make(chan os.Signal, 1)
+	changeCh := make(chan secretmanager.Change)
+	result := run(New([]string{"sh", "-c", script}, WithPolicy(DefaultPolicy)), signals, changeCh)
+	waitForFile(t, starts)
+
+	// The secret overrides the global signal policy with a restart.
+	changeCh <- secretmanager.Change{Secrets: []*secretmanager.Secret{{EnvName: "DB", OnChange: "restart"}}}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if strings.Count(waitForFile(t, starts), "start") == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if content := waitForFile(t, starts); strings.Count(content, "start") != 2 {
+		t.Fatalf("Expected the application to be started twice, got %q", content)
+	}
+
+	signals <- syscall.SIGTERM
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Expected clean exit, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervisor did not return")
+	}
+}
+
+func TestRunExecPolicy(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	hooked := filepath.Join(dir, "hooked")
+	script := `trap 'exit 0' TERM; echo ok > ` + ready + `; while true; do sleep 0.05; done`
+
+	hook, err := ParsePolicy("exec:touch " + hooked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	changeCh := make(chan secretmanager.Change)
+	result := run(New([]string{"sh", "-c", script}, WithPolicy(hook)), signals, changeCh)
+	waitForFile(t, ready)
+
+	changeCh <- secretmanager.Change{Secrets: []*secretmanager.Secret{{EnvName: "CERT"}}}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(hooked); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the hook command to run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	signals <- syscall.SIGTERM
+	if err := <-result; err != nil {
+		t.Errorf("Expected clean exit, got %v", err)
+	}
+}
+
+func TestPoliciesRestartForInjectedSecrets(t *testing.T) {
+	s := New([]string{"true"}, WithPolicy(Policy{Action: ActionNone}))
+	got := s.policies(secretmanager.Change{Secrets: []*secretmanager.Secret{
+		{EnvName: "FLAGS"},
+		{EnvName: "API_KEY", InjectEnv: true, OnChange: "none"},
+	}})
+	if len(got) != 1 || got[0].Action != ActionRestart {
+		t.Errorf("Expected a restart for an injected secret, got %v", got)
+	}
+}
+
+func TestRunReleasesRotatedValuesAfterHook(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	script := `trap 'exit 0' TERM; echo ok > ` + ready + `; while true; do sleep 0.05; done`
+	hook, err := ParsePolicy("exec:sleep 0.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := redact.New()
+	set.Put("id", []byte("old-value"))
+	set.Put("id", []byte("new-value"))
+
+	signals := make(chan os.Signal, 1)
+	changeCh := make(chan secretmanager.Change)
+	result := run(New([]string{"sh", "-c", script}, WithPolicy(hook), WithRotatedValues(set)), signals, changeCh)
+	waitForFile(t, ready)
+
+	changeCh <- secretmanager.Change{Secrets: []*secretmanager.Secret{{EnvName: "CERT"}}}
+	if got := set.String("old-value"); got != redact.Mask {
+		t.Errorf("Expected the previous value to stay redacted while the hook runs, got %q", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for set.String("old-value") != "old-value" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the previous value to be released once the hook exited")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := set.String("new-value"); got != redact.Mask {
+		t.Errorf("Expected the current value to stay redacted, got %q", got)
+	}
+
+	signals <- syscall.SIGTERM
+	if err := <-result; err != nil {
+		t.Errorf("Expected clean exit, got %v", err)
+	}
+}
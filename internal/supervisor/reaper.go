@@ -0,0 +1,140 @@
+// Package supervisor runs the wrapped application and relays signals and secret changes to it.
+package supervisor
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// orphanGrace is how long an orphaned child stays a zombie before the reaper collects it.
+const orphanGrace = time.Second
+
+// reaper collects the exit status of every child process when secretary runs as an init process.
+// Orphaned descendants are re-parented to secretary (as PID 1 or as a subreaper) and would otherwise
+// remain zombies. Processes started by the supervisor are registered with the reaper, which hands
+// their exit status over instead of discarding it.
+//
+// secretary also starts children of its own outside the supervisor, such as the credential helpers
+// run by provider SDKs, whose exec.Cmd waits for them right away. The reaper cannot tell them apart
+// from orphans, so it leaves every unregistered zombie alone for orphanGrace before collecting it.
+// A process that waits for its child only later than that loses its exit status. Orphans are only
+// found through /proc, so off Linux only registered processes are reaped.
+type reaper struct {
+	mu      sync.Mutex
+	waiters map[int]chan syscall.WaitStatus
+	// zombies holds when each unregistered zombie was first seen.
+	zombies map[int]time.Time
+	sigCh   chan os.Signal
+	done    chan struct{}
+}
+
+// newReaper starts reaping children on every SIGCHLD until stop is called.
+func newReaper() *reaper {
+	r := &reaper{
+		waiters: make(map[int]chan syscall.WaitStatus),
+		zombies: make(map[int]time.Time),
+		sigCh:   make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+	signal.Notify(r.sigCh, syscall.SIGCHLD)
+	go func() {
+		var retry <-chan time.Time
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-r.sigCh:
+			case <-retry:
+			}
+			retry = nil
+			if r.reap() {
+				retry = time.After(orphanGrace)
+			}
+		}
+	}()
+	return r
+}
+
+// start starts cmd and returns a channel receiving its wait status once it exits.
+// The reaper is locked while starting, so the status cannot be collected before the
+// process is registered.
+func (r *reaper) start(cmd *exec.Cmd) (<-chan syscall.WaitStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	ch := make(chan syscall.WaitStatus, 1)
+	r.waiters[cmd.Process.Pid] = ch
+	return ch, nil
+}
+
+// reap collects the registered processes that exited, and the unregistered zombies that were seen
+// at least orphanGrace ago, without blocking. It reports whether zombies are left to collect later.
+func (r *reaper) reap() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for pid, ch := range r.waiters {
+		if status, ok := wait(pid); ok {
+			delete(r.waiters, pid)
+			ch <- status
+		}
+	}
+
+	now := time.Now()
+	zombies := make(map[int]time.Time)
+	for _, pid := range zombieChildren() {
+		if _, ok := r.waiters[pid]; ok {
+			continue
+		}
+		seen, ok := r.zombies[pid]
+		if !ok {
+			seen = now
+		}
+		if now.Sub(seen) < orphanGrace {
+			zombies[pid] = seen
+			continue
+		}
+		if _, ok := wait(pid); ok {
+			slog.Debug("Reaped orphaned process", "pid", pid)
+		}
+	}
+	r.zombies = zombies
+	return len(zombies) > 0
+}
+
+// wait collects the exit status of the child pid if it exited, without blocking.
+func wait(pid int) (syscall.WaitStatus, bool) {
+	for {
+		var status syscall.WaitStatus
+		got, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		return status, err == nil && got == pid
+	}
+}
+
+// stop stops reaping.
+func (r *reaper) stop() {
+	signal.Stop(r.sigCh)
+	close(r.done)
+}
+
+// exitError reports a process that did not exit successfully, as observed by the reaper.
+type exitError struct {
+	status syscall.WaitStatus
+}
+
+func (e *exitError) Error() string {
+	if e.status.Signaled() {
+		return fmt.Sprintf("signal: %s", e.status.Signal())
+	}
+	return fmt.Sprintf("exit status %d", e.status.ExitStatus())
+}
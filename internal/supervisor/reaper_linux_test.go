@@ -0,0 +1,106 @@
+//go:build linux
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+)
+
+// resetSubreaper unregisters the test process as child subreaper once the test is done.
+func resetSubreaper(t *testing.T) {
+	t.Cleanup(func() {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 0, 0); errno != 0 {
+			t.Errorf("Failed to reset the child subreaper: %v", errno)
+		}
+	})
+}
+
+func TestRunInitReapsOrphans(t *testing.T) {
+	resetSubreaper(t)
+	pidFile := filepath.Join(t.TempDir(), "orphan")
+	// The inner shell exits right away, orphaning the background sleep, which is
+	// re-parented to the test process registered as subreaper and reaped after orphanGrace.
+	script := `sh -c 'sleep 0.1 & echo $! > ` + pidFile + `'; sleep 1.5; exit 3`
+
+	err := New([]string{"sh", "-c", script}, WithInit(true)).Run(context.Background(), make(chan os.Signal), make(chan secretmanager.Change))
+	if code := ExitCode(err); code != 3 {
+		t.Errorf("Expected exit code 3 in init mode, got %d (%v)", code, err)
+	}
+
+	content, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("Failed to read orphan pid: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err == nil && strings.Contains(string(stat), ") Z ") {
+		t.Errorf("Expected orphan %d to be reaped, found zombie: %s", pid, stat)
+	}
+}
+
+func TestRunInitLeavesOwnedChildren(t *testing.T) {
+	resetSubreaper(t)
+	result := make(chan error, 1)
+	go func() {
+		result <- New([]string{"sleep", "1"}, WithInit(true)).Run(context.Background(), make(chan os.Signal), make(chan secretmanager.Change))
+	}()
+
+	// Children started outside the supervisor, like the credential helpers of provider SDKs,
+	// keep their exit status for their own exec.Cmd.
+	time.Sleep(100 * time.Millisecond)
+	for range 20 {
+		err := exec.Command("sh", "-c", "exit 7").Run()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 7 {
+			t.Fatalf("Expected the helper to exit with status 7, got %v", err)
+		}
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Expected the application to exit successfully, got %v", err)
+	}
+}
+
+func TestRunInitProcessGroup(t *testing.T) {
+	resetSubreaper(t)
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	got := filepath.Join(dir, "got")
+	// The signal is delivered to the whole group, so the grandchild records it.
+	script := `sh -c 'trap "echo term > ` + got + `; exit 0" TERM; while true; do sleep 0.05; done' & echo ok > ` + ready + `; wait`
+
+	signals := make(chan os.Signal, 1)
+	result := make(chan error, 1)
+	go func() {
+		s := New([]string{"sh", "-c", script}, WithInit(true), WithProcessGroup(true), WithShutdownTimeout(5*time.Second))
+		result <- s.Run(context.Background(), signals, make(chan secretmanager.Change))
+	}()
+	waitForFile(t, ready)
+
+	signals <- syscall.SIGTERM
+	select {
+	case err := <-result:
+		if code := ExitCode(err); code != 128+int(syscall.SIGTERM) {
+			t.Errorf("Expected the child to be terminated by SIGTERM, got %d (%v)", code, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervisor did not return")
+	}
+	if content := waitForFile(t, got); content != "term\n" {
+		t.Errorf("Expected grandchild to receive SIGTERM, got %q", content)
+	}
+}
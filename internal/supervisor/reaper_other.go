@@ -0,0 +1,15 @@
+//go:build !linux
+
+package supervisor
+
+import "errors"
+
+// setSubreaper is only supported on Linux. Elsewhere secretary can still reap zombies when it runs as PID 1.
+func setSubreaper() error {
+	return errors.New("child subreaper is only supported on linux")
+}
+
+// zombieChildren is only supported on Linux, where it reads /proc.
+func zombieChildren() []int {
+	return nil
+}
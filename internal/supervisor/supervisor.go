@@ -0,0 +1,474 @@
+// Package supervisor runs the wrapped application and relays signals and secret changes to it.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/audit"
+	"github.com/fr0stylo/secretary/internal/logging"
+	"github.com/fr0stylo/secretary/internal/metrics"
+	"github.com/fr0stylo/secretary/internal/redact"
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+	"github.com/fr0stylo/secretary/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of signals and restarts.
+var tracer = tracing.Tracer("github.com/fr0stylo/secretary/internal/supervisor")
+
+// ForwardedSignals lists the signals relayed to the child process as is.
+// SIGTERM and SIGINT additionally start the graceful shutdown period.
+var ForwardedSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+}
+
+// Supervisor starts a child process and manages it for its whole lifetime.
+type Supervisor struct {
+	args            []string
+	shutdownTimeout time.Duration
+	init            bool
+	processGroup    bool
+	policy          Policy
+	redact          *redact.Set
+	rotated         *redact.Set
+	audit           *audit.Log
+
+	// reaper collects the exit status of all children in init mode.
+	reaper *reaper
+	// running is set while the application is running.
+	running atomic.Bool
+}
+
+// Option is a function that modifies a Supervisor.
+type Option func(*Supervisor)
+
+// WithShutdownTimeout sets how long the child may take to exit after a termination signal
+// was forwarded before it is killed with SIGKILL.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(s *Supervisor) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// WithInit enables init mode for running as PID 1: secretary registers as a child subreaper
+// and reaps every zombie process, so no separate init such as tini is needed.
+func WithInit(enabled bool) Option {
+	return func(s *Supervisor) {
+		s.init = enabled
+	}
+}
+
+// WithProcessGroup starts the child in its own process group and delivers every signal to the
+// whole group, reaching processes spawned by the application as well.
+func WithProcessGroup(enabled bool) Option {
+	return func(s *Supervisor) {
+		s.processGroup = enabled
+	}
+}
+
+// WithPolicy sets the reload policy applied when secrets change, unless a secret overrides it.
+func WithPolicy(policy Policy) Option {
+	return func(s *Supervisor) {
+		s.policy = policy
+	}
+}
+
+// WithRedactedOutput streams the stdout and stderr of the application and its hooks through
+// filters replacing every value of set, including its base64 and URL-escaped forms, with
+// OutputMask. Values registered while the application runs, such as rotated secrets, are
+// picked up as they are.
+func WithRedactedOutput(set *redact.Set) Option {
+	return func(s *Supervisor) {
+		s.redact = set
+	}
+}
+
+// WithRotatedValues releases the replaced values of rotated secrets in set once the application
+// was reloaded with the new ones: after it was signalled, after the reload hooks exited, or after
+// it was restarted. Until then it may still log or print the previous values.
+func WithRotatedValues(set *redact.Set) Option {
+	return func(s *Supervisor) {
+		s.rotated = set
+	}
+}
+
+// WithAudit records every notification of the application about a change in the audit log.
+func WithAudit(log *audit.Log) Option {
+	return func(s *Supervisor) {
+		s.audit = log
+	}
+}
+
+// New creates a Supervisor for the command described by args.
+func New(args []string, opts ...Option) *Supervisor {
+	s := &Supervisor{
+		args:            args,
+		shutdownTimeout: 10 * time.Second,
+		policy:          DefaultPolicy,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run starts the child process and blocks until it exits, returning the result of waiting for it.
+// Signals received on signals are forwarded to the child. SIGTERM and SIGINT, as well as the
+// cancellation of ctx, start a graceful shutdown: the child gets the shutdown timeout to exit
+// before it is killed. Every change received on changeCh is handled according to the reload
+// policies of the changed secrets.
+func (s *Supervisor) Run(ctx context.Context, signals <-chan os.Signal, changeCh <-chan secretmanager.Change) error {
+	if len(s.args) == 0 {
+		return errors.New("no command to run")
+	}
+	if s.init {
+		if err := setSubreaper(); err != nil {
+			slog.Warn("Could not register as child subreaper", logging.Err(err))
+		}
+		s.reaper = newReaper()
+		defer func() {
+			s.reaper.stop()
+			s.reaper = nil
+		}()
+	}
+
+	cmd, complete, err := s.startChild()
+	if err != nil {
+		return err
+	}
+
+	var killTimer <-chan time.Time
+	shuttingDown, restarting := false, false
+	// restarted releases the values replaced before the restart once the application started again.
+	restarted := func() {}
+	var restartSpan trace.Span
+	stop := func(ctx context.Context, sig os.Signal) {
+		slog.Info("Sending signal", "signal", osSignalName(sig), "pid", cmd.Process.Pid)
+		if err := s.signal(ctx, cmd, sig); err != nil {
+			slog.Error("Error sending signal", "signal", osSignalName(sig), "pid", cmd.Process.Pid, logging.Err(err))
+		}
+		if killTimer == nil {
+			killTimer = time.After(s.shutdownTimeout)
+		}
+	}
+
+	done := ctx.Done()
+	for {
+		select {
+		case change := <-changeCh:
+			if shuttingDown || restarting {
+				continue
+			}
+			cctx := trace.ContextWithSpanContext(ctx, change.SpanContext)
+			release := s.released()
+			var hooks sync.WaitGroup
+			for _, p := range s.policies(change) {
+				switch p.Action {
+				case ActionSignal:
+					slog.Info("Change detected, sending signal", "change_time", change.Time, "signal", signalName(p.Signal), "pid", cmd.Process.Pid)
+					err := s.signal(cctx, cmd, p.Signal)
+					s.notified(p, err)
+					if err != nil {
+						// The application may be exiting, in which case its exit status follows on complete.
+						slog.Error("Error sending signal", "signal", signalName(p.Signal), "pid", cmd.Process.Pid, logging.Err(err))
+					}
+				case ActionExec:
+					slog.Info("Change detected, running hook", "change_time", change.Time, "command", p.Command)
+					hooks.Add(1)
+					s.notified(p, s.runHook(cctx, p.Command, hooks.Done))
+				case ActionRestart:
+					slog.Info("Change detected, restarting the application", "change_time", change.Time, "pid", cmd.Process.Pid, "grace_period", s.shutdownTimeout)
+					restarting, restarted = true, release
+					s.notified(p, nil)
+					var rctx context.Context
+					rctx, restartSpan = tracer.Start(cctx, "RestartApplication", trace.WithAttributes(attribute.Int("process.pid", cmd.Process.Pid)))
+					stop(rctx, syscall.SIGTERM)
+				}
+			}
+			if !restarting {
+				go func() {
+					hooks.Wait()
+					release()
+				}()
+			}
+		case sig := <-signals:
+			if sig == syscall.SIGTERM || sig == syscall.SIGINT {
+				slog.Info("Received signal, shutting down", "signal", osSignalName(sig), "grace_period", s.shutdownTimeout)
+				shuttingDown = true
+				stop(ctx, sig)
+				continue
+			}
+			slog.Info("Forwarding signal", "signal", osSignalName(sig), "pid", cmd.Process.Pid)
+			if err := s.signal(ctx, cmd, sig); err != nil {
+				slog.Error("Error forwarding signal", "signal", osSignalName(sig), "pid", cmd.Process.Pid, logging.Err(err))
+			}
+		case <-done:
+			done = nil
+			slog.Info("Context cancelled, shutting down", "grace_period", s.shutdownTimeout)
+			shuttingDown = true
+			stop(ctx, syscall.SIGTERM)
+		case <-killTimer:
+			killTimer = nil
+			slog.Warn("Shutdown timeout exceeded, sending SIGKILL", "grace_period", s.shutdownTimeout, "pid", cmd.Process.Pid)
+			// The application may exit just as the grace period expires; its exit status
+			// then follows on complete.
+			if err := s.signal(ctx, cmd, syscall.SIGKILL); err != nil && !exited(err) {
+				return err
+			}
+		case err := <-complete:
+			s.running.Store(false)
+			if !restarting || shuttingDown {
+				if restartSpan != nil {
+					tracing.End(restartSpan, errors.New("shut down during restart"))
+				}
+				return err
+			}
+			restarting, killTimer = false, nil
+			slog.Info("Application stopped, starting it again", logging.Err(err))
+			metrics.ChildRestarts.Inc()
+			cmd, complete, err = s.startChild()
+			tracing.End(restartSpan, err)
+			restartSpan = nil
+			if err != nil {
+				return err
+			}
+			restarted()
+		}
+	}
+}
+
+// policies resolves the reload policies of everything in a change, combining them into the
+// actions to perform. Secrets may override the supervisor's policy with their OnChange option.
+// Secrets injected into the environment always restart the application, as the environment of
+// a running process cannot be changed.
+func (s *Supervisor) policies(change secretmanager.Change) []Policy {
+	policies := make([]Policy, 0, len(change.Secrets)+len(change.Templates))
+	for _, secret := range change.Secrets {
+		if secret.InjectEnv {
+			policies = append(policies, Policy{Action: ActionRestart})
+			continue
+		}
+		policy := s.policy
+		if secret.OnChange != "" {
+			p, err := ParsePolicy(secret.OnChange)
+			if err != nil {
+				slog.Warn("Invalid reload policy, using the default", logging.EnvName, secret.EnvName, "policy", s.policy.String(), logging.Err(err))
+			} else {
+				policy = p
+			}
+		}
+		policies = append(policies, policy)
+	}
+	for range change.Templates {
+		policies = append(policies, s.policy)
+	}
+	return combine(policies)
+}
+
+// startChild starts a new instance of the application with the current environment.
+func (s *Supervisor) startChild() (*exec.Cmd, <-chan error, error) {
+	cmd := exec.Command(s.args[0], s.args[1:]...)
+
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if s.processGroup {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+
+	complete, err := s.start(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.running.Store(true)
+	return cmd, complete, nil
+}
+
+// Alive reports whether the application is running.
+func (s *Supervisor) Alive() bool {
+	return s.running.Load()
+}
+
+// notified records a notification of the application in the audit log.
+func (s *Supervisor) notified(p Policy, err error) {
+	entry := audit.Entry{Event: audit.EventNotify, Action: p.String()}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	s.audit.Record(entry)
+}
+
+// released returns a function releasing the values of rotated secrets replaced so far.
+func (s *Supervisor) released() func() {
+	if s.rotated == nil {
+		return func() {}
+	}
+	generation := s.rotated.Generation()
+	return func() { s.rotated.Release(generation) }
+}
+
+// runHook runs a reload hook command in the background and logs its result, calling done once
+// it exited or could not be started. It returns an error if the command could not be started.
+func (s *Supervisor) runHook(ctx context.Context, command []string, done func()) error {
+	_, span := tracer.Start(ctx, "RunHook", trace.WithAttributes(attribute.StringSlice("process.command_args", command)))
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	complete, err := s.start(cmd)
+	if err != nil {
+		slog.Error("Error running hook", "command", command, logging.Err(err))
+		tracing.End(span, err)
+		done()
+		return err
+	}
+	go func() {
+		defer done()
+		err := <-complete
+		if err != nil {
+			slog.Error("Hook failed", "command", command, logging.Err(err))
+		}
+		tracing.End(span, err)
+	}()
+	return nil
+}
+
+// start starts cmd and returns a channel receiving the result of waiting for it.
+// In init mode the process is handed to the reaper, which collects its exit status.
+// When output redaction is enabled, the result is received once the output was written.
+func (s *Supervisor) start(cmd *exec.Cmd) (<-chan error, error) {
+	if s.redact == nil {
+		return s.startProcess(cmd)
+	}
+	output, err := redactOutput(cmd, s.redact)
+	if err != nil {
+		return nil, err
+	}
+	complete, err := s.startProcess(cmd)
+	output.started()
+	if err != nil {
+		return nil, err
+	}
+	drained := make(chan error, 1)
+	go func() {
+		err := <-complete
+		output.drain()
+		drained <- err
+	}()
+	return drained, nil
+}
+
+// startProcess starts cmd and returns a channel receiving the result of waiting for it.
+func (s *Supervisor) startProcess(cmd *exec.Cmd) (<-chan error, error) {
+	complete := make(chan error, 1)
+	if s.reaper == nil {
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		go func() {
+			complete <- cmd.Wait()
+		}()
+		return complete, nil
+	}
+
+	statusCh, err := s.reaper.start(cmd)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		status := <-statusCh
+		if status.Exited() && status.ExitStatus() == 0 {
+			complete <- nil
+			return
+		}
+		complete <- &exitError{status: status}
+	}()
+	return complete, nil
+}
+
+// signal delivers sig to the child, or to its whole process group when enabled.
+func (s *Supervisor) signal(ctx context.Context, cmd *exec.Cmd, sig os.Signal) (err error) {
+	name := osSignalName(sig)
+	_, span := tracer.Start(ctx, "SignalApplication", trace.WithAttributes(
+		attribute.String("secretary.signal", name),
+		attribute.Int("process.pid", cmd.Process.Pid),
+	))
+	defer func() { tracing.End(span, err) }()
+	metrics.SignalsSent.WithLabelValues(name).Inc()
+
+	if !s.processGroup {
+		return cmd.Process.Signal(sig)
+	}
+	sysSig, ok := sig.(syscall.Signal)
+	if !ok {
+		return cmd.Process.Signal(sig)
+	}
+	return syscall.Kill(-cmd.Process.Pid, sysSig)
+}
+
+// exited reports whether a signal could not be delivered because the application already exited.
+func exited(err error) bool {
+	return errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH)
+}
+
+// osSignalName returns the name of sig as used in logs, metrics and spans.
+func osSignalName(sig os.Signal) string {
+	if sysSig, ok := sig.(syscall.Signal); ok {
+		return signalName(sysSig)
+	}
+	return sig.String()
+}
+
+// ExitCode translates the result of Run into the exit code secretary should exit with,
+// following the conventions of shells and init systems: the child's own exit code when it
+// exited, 128 plus the signal number when it was killed by a signal, 127 when the command
+// could not be found and 126 when it could not be executed.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var reaped *exitError
+	if errors.As(err, &reaped) {
+		return waitStatusCode(reaped.status)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return waitStatusCode(status)
+		}
+		return exitErr.ExitCode()
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return 127
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return 126
+	}
+	return 1
+}
+
+// waitStatusCode returns the exit code described by a wait status.
+func waitStatusCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
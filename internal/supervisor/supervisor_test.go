@@ -0,0 +1,177 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/audit"
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+)
+
+// waitForFile polls until the file at p exists and returns its contents.
+func waitForFile(t *testing.T, p string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if content, err := os.ReadFile(p); err == nil && len(content) > 0 {
+			return string(content)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", p)
+	return ""
+}
+
+// run starts the supervisor in the background and returns a channel with its result.
+func run(s *Supervisor, signals chan os.Signal, changeCh chan secretmanager.Change) chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Run(context.Background(), signals, changeCh)
+	}()
+	return result
+}
+
+func TestRunForwardsSignals(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	got := filepath.Join(dir, "got")
+	script := `trap 'echo usr1 > ` + got + `; exit 0' USR1; echo ok > ` + ready + `; while true; do sleep 0.05; done`
+
+	signals := make(chan os.Signal, 1)
+	result := run(New([]string{"sh", "-c", script}), signals, make(chan secretmanager.Change))
+	waitForFile(t, ready)
+
+	signals <- syscall.SIGUSR1
+	if content := waitForFile(t, got); content != "usr1\n" {
+		t.Errorf("Expected child to receive SIGUSR1, got %q", content)
+	}
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Expected clean exit, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervisor did not return")
+	}
+}
+
+func TestRunGracefulShutdown(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	got := filepath.Join(dir, "got")
+	script := `trap 'echo term > ` + got + `; exit 0' TERM; echo ok > ` + ready + `; while true; do sleep 0.05; done`
+
+	signals := make(chan os.Signal, 1)
+	result := run(New([]string{"sh", "-c", script}, WithShutdownTimeout(5*time.Second)), signals, make(chan secretmanager.Change))
+	waitForFile(t, ready)
+
+	signals <- syscall.SIGTERM
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Expected the child to drain and exit cleanly, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervisor did not return")
+	}
+	if content := waitForFile(t, got); content != "term\n" {
+		t.Errorf("Expected child to receive SIGTERM, got %q", content)
+	}
+}
+
+func TestRunKillsAfterShutdownTimeout(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	script := `trap '' TERM; echo ok > ` + ready + `; while true; do sleep 0.05; done`
+
+	signals := make(chan os.Signal, 1)
+	result := run(New([]string{"sh", "-c", script}, WithShutdownTimeout(100*time.Millisecond)), signals, make(chan secretmanager.Change))
+	waitForFile(t, ready)
+
+	start := time.Now()
+	signals <- syscall.SIGTERM
+	select {
+	case err := <-result:
+		if code := ExitCode(err); code != 128+int(syscall.SIGKILL) {
+			t.Errorf("Expected exit code %d for a killed child, got %d", 128+int(syscall.SIGKILL), code)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("Expected the child to be killed after the shutdown timeout, took %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervisor did not kill the child")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{args: []string{"sh", "-c", "exit 0"}, want: 0},
+		{args: []string{"sh", "-c", "exit 42"}, want: 42},
+		{args: []string{"sh", "-c", "kill -TERM $$"}, want: 128 + int(syscall.SIGTERM)},
+		{args: []string{"sh", "-c", "kill -KILL $$"}, want: 128 + int(syscall.SIGKILL)},
+		{args: []string{"secretary-test-command-that-does-not-exist"}, want: 127},
+	}
+	for _, tt := range tests {
+		err := New(tt.args).Run(context.Background(), make(chan os.Signal), make(chan secretmanager.Change))
+		if got := ExitCode(err); got != tt.want {
+			t.Errorf("%v: expected exit code %d, got %d (%v)", tt.args, tt.want, got, err)
+		}
+	}
+}
+
+func TestExited(t *testing.T) {
+	for _, processGroup := range []bool{false, true} {
+		s := New([]string{"true"}, WithProcessGroup(processGroup))
+		cmd, complete, err := s.startChild()
+		if err != nil {
+			t.Fatalf("startChild failed: %v", err)
+		}
+		<-complete
+		err = s.signal(context.Background(), cmd, syscall.SIGKILL)
+		if !exited(err) {
+			t.Errorf("process group %t: expected signalling an exited application to report it exited, got %v", processGroup, err)
+		}
+	}
+	if exited(errors.New("operation not permitted")) || exited(nil) {
+		t.Error("Expected other errors not to be reported as exited")
+	}
+}
+
+func TestRunAuditsNotifications(t *testing.T) {
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	got := filepath.Join(dir, "got")
+	script := `trap 'echo hup > ` + got + `; exit 0' HUP; echo ok > ` + ready + `; while true; do sleep 0.05; done`
+
+	var buf bytes.Buffer
+	log, err := audit.New(&buf, []byte("audit-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeCh := make(chan secretmanager.Change)
+	result := run(New([]string{"sh", "-c", script}, WithAudit(log)), make(chan os.Signal), changeCh)
+	waitForFile(t, ready)
+
+	changeCh <- secretmanager.Change{Time: time.Now(), Secrets: []*secretmanager.Secret{{EnvName: "DB"}}}
+	waitForFile(t, got)
+	select {
+	case <-result:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervisor did not return")
+	}
+
+	if !strings.Contains(buf.String(), `"event":"notify"`) || !strings.Contains(buf.String(), `"action":"signal:SIGHUP"`) {
+		t.Errorf("Expected the notification to be audited, got %q", buf.String())
+	}
+}
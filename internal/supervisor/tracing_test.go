@@ -0,0 +1,67 @@
+package supervisor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fr0stylo/secretary/internal/secretmanager"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// The global tracer provider only delegates to the first provider installed, so every test of
+// the package shares one.
+var (
+	installSpans sync.Once
+	exp          = tracetest.NewInMemoryExporter()
+	tp           = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+)
+
+func TestChangeSignalSpan(t *testing.T) {
+	installSpans.Do(func() { otel.SetTracerProvider(tp) })
+	exp.Reset()
+
+	dir := t.TempDir()
+	ready := filepath.Join(dir, "ready")
+	got := filepath.Join(dir, "got")
+	script := `trap 'echo hup > ` + got + `; exit 0' HUP; echo ok > ` + ready + `; while true; do sleep 0.05; done`
+
+	changeCh := make(chan secretmanager.Change)
+	result := run(New([]string{"sh", "-c", script}), make(chan os.Signal), changeCh)
+	waitForFile(t, ready)
+
+	_, check := tp.Tracer("test").Start(context.Background(), "WatcherCheck")
+	check.End()
+	changeCh <- secretmanager.Change{Time: time.Now(), Secrets: []*secretmanager.Secret{{EnvName: "DB"}}, SpanContext: check.SpanContext()}
+	waitForFile(t, got)
+	select {
+	case <-result:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Supervisor did not return")
+	}
+
+	var signal *tracetest.SpanStub
+	spans := exp.GetSpans()
+	for i := range spans {
+		if spans[i].Name == "SignalApplication" {
+			signal = &spans[i]
+		}
+	}
+	if signal == nil {
+		t.Fatalf("Expected a SignalApplication span, got %d spans", len(spans))
+	}
+	if signal.Parent.SpanID() != check.SpanContext().SpanID() {
+		t.Error("Expected the signal span to be a child of the watcher check")
+	}
+	for _, kv := range signal.Attributes {
+		if kv.Key == "secretary.signal" && kv.Value.AsString() != signalName(syscall.SIGHUP) {
+			t.Errorf("Expected signal attribute SIGHUP, got %s", kv.Value.AsString())
+		}
+	}
+}
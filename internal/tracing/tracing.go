@@ -0,0 +1,92 @@
+// Package tracing configures OpenTelemetry tracing and provides helpers shared by the instrumented packages.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys used on secretary spans.
+const (
+	Provider   = attribute.Key("secretary.provider")
+	Identifier = attribute.Key("secretary.secret.identifier")
+	EnvName    = attribute.Key("secretary.secret.env_name")
+	Version    = attribute.Key("secretary.secret.version")
+	Outcome    = attribute.Key("secretary.outcome")
+)
+
+// Tracer returns the tracer of an instrumented package. It delegates to the global tracer
+// provider, so spans are exported once Setup has run and dropped otherwise.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// End records the outcome of an operation on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(Outcome.String("error"))
+	} else {
+		span.SetAttributes(Outcome.String("success"))
+	}
+	span.End()
+}
+
+// Enabled reports whether the standard OTEL_* environment variables ask for traces to be
+// exported over OTLP: an OTLP endpoint or OTEL_TRACES_EXPORTER=otlp must be set, and
+// OTEL_SDK_DISABLED must not be true.
+func Enabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "otlp":
+		return true
+	case "":
+	default:
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs a global tracer provider exporting spans over OTLP/HTTP when Enabled.
+// The exporter, sampler and resource are configured with the standard OTEL_* environment
+// variables, and the service name defaults to secretary. The returned function flushes
+// pending spans and must be called before exiting.
+func Setup(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName("secretary")),
+		resource.Environment(),
+	)
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want bool
+	}{
+		{map[string]string{}, false},
+		{map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, true},
+		{map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector:4318/v1/traces"}, true},
+		{map[string]string{"OTEL_TRACES_EXPORTER": "otlp"}, true},
+		{map[string]string{"OTEL_TRACES_EXPORTER": "none", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, false},
+		{map[string]string{"OTEL_SDK_DISABLED": "true", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, false},
+	}
+	for _, tt := range tests {
+		for _, key := range []string{"OTEL_SDK_DISABLED", "OTEL_TRACES_EXPORTER", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"} {
+			t.Setenv(key, tt.env[key])
+		}
+		if got := Enabled(); got != tt.want {
+			t.Errorf("Enabled() with %v = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestEnd(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)).Tracer("test")
+
+	_, ok := tracer.Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := tracer.Start(context.Background(), "failed")
+	End(failed, errors.New("boom"))
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	outcome := func(s tracetest.SpanStub) string {
+		for _, kv := range s.Attributes {
+			if kv.Key == Outcome {
+				return kv.Value.AsString()
+			}
+		}
+		return ""
+	}
+	if outcome(spans[0]) != "success" || outcome(spans[1]) != "error" {
+		t.Errorf("Unexpected outcomes %q and %q", outcome(spans[0]), outcome(spans[1]))
+	}
+	if len(spans[1].Events) == 0 {
+		t.Error("Expected the error to be recorded")
+	}
+}